@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"effective_mobile/api/graphql"
+	"effective_mobile/api/rest"
+	"effective_mobile/enrichment"
+	"effective_mobile/problem"
+	"effective_mobile/service"
+)
+
+// Config configures the HTTP API.
+type Config struct {
+	// AdminToken grants admin-only features to requests carrying it in X-Admin-Token; empty disables them.
+	AdminToken string
+	// Enricher enables the admin API of its cache under /api/admin/cache when set.
+	Enricher *enrichment.APIEnricher
+	GraphQL  graphql.Config
+}
+
+// NewRouter builds the router serving the REST API under /api and GraphQL under /graphql.
+func NewRouter(personService service.PersonService, config Config) (*gin.Engine, error) {
+	schema, err := graphql.NewSchema(personService)
+	if err != nil {
+		return nil, err
+	}
+
+	router := gin.Default()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(c *gin.Context) {
+		problem.Write(c, problem.New(http.StatusNotFound, "No route for "+c.Request.URL.Path))
+	})
+	router.NoMethod(func(c *gin.Context) {
+		problem.Write(c, problem.New(http.StatusMethodNotAllowed, c.Request.Method+" is not allowed for "+c.Request.URL.Path))
+	})
+
+	rest.NewHandler(personService, config.AdminToken).Register(router)
+	if config.Enricher != nil {
+		rest.NewCacheHandler(personService, config.Enricher, config.AdminToken).Register(router)
+	}
+
+	graphqlConfig := config.GraphQL
+	graphqlConfig.AdminToken = config.AdminToken
+	graphql.NewServer(schema, personService, graphqlConfig).Register(router)
+
+	return router, nil
+}
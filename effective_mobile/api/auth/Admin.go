@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenHeader carries the token granting access to admin-only features.
+const AdminTokenHeader = "X-Admin-Token"
+
+// ActorHeader names the caller recorded in the change history.
+const ActorHeader = "X-Actor"
+
+// IsAdmin reports whether the request carries the admin token. Admin access is disabled when adminToken is empty.
+func IsAdmin(c *gin.Context, adminToken string) bool {
+	if adminToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.GetHeader(AdminTokenHeader)), []byte(adminToken)) == 1
+}
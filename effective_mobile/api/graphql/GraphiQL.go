@@ -0,0 +1,22 @@
+package graphql
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed graphiql.html
+var graphiqlPage []byte
+
+// wantsGraphiQL reports whether a GET /graphql request comes from a browser rather
+// than a GraphQL client: it carries no query and accepts HTML.
+func wantsGraphiQL(c *gin.Context) bool {
+	return c.Query("query") == "" && c.Query("extensions") == "" && strings.Contains(c.GetHeader("Accept"), "text/html")
+}
+
+func serveGraphiQL(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", graphiqlPage)
+}
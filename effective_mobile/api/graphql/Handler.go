@@ -0,0 +1,334 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+
+	"effective_mobile/api/auth"
+	"effective_mobile/dataloader"
+	"effective_mobile/entities"
+	"effective_mobile/sdl"
+	"effective_mobile/service"
+)
+
+const responseContentType = "application/graphql-response+json"
+
+// maxBatchSize bounds the number of operations accepted in one batched request.
+const maxBatchSize = 20
+
+// requestInfoKey carries the requestInfo of the current GraphQL request into the resolvers.
+type requestInfoKey struct{}
+
+// personLoaderKey carries the dataloader.PersonLoader of the operation being executed.
+type personLoaderKey struct{}
+
+type requestInfo struct {
+	Origin entities.ChangeOrigin
+	Admin  bool
+}
+
+// operationParams is a single GraphQL operation as sent over HTTP.
+type operationParams struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// Config tunes how a Server executes operations.
+type Config struct {
+	Limits Limits
+	// PersistedQueries is the persisted query store; nil accepts any query and registers none.
+	PersistedQueries *PersistedQueries
+	// GraphiQL serves the GraphiQL IDE to browsers opening /graphql.
+	GraphiQL bool
+	// AdminToken grants admin-only features to requests carrying it; empty disables them.
+	AdminToken string
+	// AllowedOrigins lists the origins of the pages allowed to open a WebSocket, besides
+	// the pages served from the host of /graphql, e.g. https://app.example.com.
+	AllowedOrigins []string
+}
+
+// Server executes GraphQL operations within the configured limits.
+type Server struct {
+	schema         graphql.Schema
+	personService  service.PersonService
+	limits         Limits
+	persisted      *PersistedQueries
+	graphiql       bool
+	adminToken     string
+	allowedOrigins []string
+}
+
+func NewServer(schema graphql.Schema, personService service.PersonService, config Config) *Server {
+	persisted := config.PersistedQueries
+	if persisted == nil {
+		persisted, _ = LoadPersistedQueries("", false)
+	}
+
+	return &Server{
+		schema:         schema,
+		personService:  personService,
+		limits:         config.Limits,
+		persisted:      persisted,
+		graphiql:       config.GraphiQL,
+		adminToken:     config.AdminToken,
+		allowedOrigins: config.AllowedOrigins,
+	}
+}
+
+// Register mounts the GraphQL endpoint and the schema SDL on the router.
+func (s *Server) Register(router gin.IRoutes) {
+	handler := s.Handler()
+	router.GET("/graphql", handler)
+	router.POST("/graphql", handler)
+	router.GET("/graphql/schema.graphql", SchemaHandler(s.schema))
+}
+
+// Handler serves GraphQL over HTTP: queries over GET, any operation over POST,
+// batches of operations as a JSON array over POST, and queries and subscriptions
+// over a graphql-transport-ws WebSocket.
+func (s *Server) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request := requestInfo{
+			Origin: entities.ChangeOrigin{Actor: c.GetHeader(auth.ActorHeader), Source: entities.SourceGraphQL},
+			Admin:  auth.IsAdmin(c, s.adminToken),
+		}
+		ctx := context.WithValue(c.Request.Context(), requestInfoKey{}, request)
+
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			serveWebSocket(c.Writer, c.Request, s, ctx)
+			return
+		}
+
+		if c.Request.Method == http.MethodGet {
+			if s.graphiql && wantsGraphiQL(c) {
+				serveGraphiQL(c)
+				return
+			}
+
+			params, err := graphqlParamsFromQuery(c)
+			if err != nil {
+				writeRequestError(c, err.Error())
+				return
+			}
+			if result := s.prepare(&params); result != nil {
+				writeResult(c, result)
+				return
+			}
+			switch operationType(params) {
+			case ast.OperationTypeMutation:
+				c.Header("Allow", http.MethodPost)
+				writeError(c, http.StatusMethodNotAllowed, "Mutations are only allowed over POST")
+				return
+			case ast.OperationTypeSubscription:
+				writeError(c, http.StatusMethodNotAllowed, "Subscriptions are only allowed over a WebSocket")
+				return
+			}
+			writeResult(c, s.run(ctx, params))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			writeRequestError(c, "Error reading request body")
+			return
+		}
+
+		if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+			var batch []operationParams
+			if err := json.Unmarshal(body, &batch); err != nil {
+				writeRequestError(c, "Invalid JSON format")
+				return
+			}
+			if len(batch) == 0 || len(batch) > maxBatchSize {
+				writeRequestError(c, fmt.Sprintf("Batch must contain between 1 and %d operations", maxBatchSize))
+				return
+			}
+
+			results := make([]*graphql.Result, len(batch))
+			for i := range batch {
+				results[i] = s.execute(ctx, batch[i])
+			}
+			writeJSON(c, http.StatusOK, results)
+			return
+		}
+
+		var params operationParams
+		if err := json.Unmarshal(body, &params); err != nil {
+			writeRequestError(c, "Invalid JSON format")
+			return
+		}
+
+		writeResult(c, s.execute(ctx, params))
+	}
+}
+
+// SchemaHandler serves the schema in the GraphQL schema definition language.
+func SchemaHandler(schema graphql.Schema) gin.HandlerFunc {
+	printed := []byte(sdl.Print(schema))
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", printed)
+	}
+}
+
+// execute prepares and runs a single operation.
+func (s *Server) execute(ctx context.Context, params operationParams) *graphql.Result {
+	if result := s.prepare(&params); result != nil {
+		return result
+	}
+	return s.run(ctx, params)
+}
+
+// prepare resolves a persisted query and checks the operation against the limits,
+// returning the result to answer with when the operation must not run.
+func (s *Server) prepare(params *operationParams) *graphql.Result {
+	if err := s.persisted.resolve(params); err != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{*err}}
+	}
+	if params.Query == "" {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError("Request must contain a query")}}
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: params.Query})
+	if err != nil {
+		// Execution reports the syntax error
+		return nil
+	}
+	if err := checkLimits(s.schema, document, *params, s.limits); err != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{*err}}
+	}
+	return nil
+}
+
+// run executes a prepared query or mutation, giving up after the configured timeout.
+// Each operation batches and caches its person lookups in a loader of its own.
+func (s *Server) run(ctx context.Context, params operationParams) *graphql.Result {
+	ctx = context.WithValue(ctx, personLoaderKey{}, dataloader.NewPersonLoader(s.personService.GetPeopleByIDs))
+	if s.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.limits.Timeout)
+		defer cancel()
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  params.Query,
+		VariableValues: params.Variables,
+		OperationName:  params.OperationName,
+		Context:        ctx,
+	})
+	for i := range result.Errors {
+		if result.Errors[i].Extensions == nil {
+			result.Errors[i].Extensions = errorExtensions(result.Errors[i].OriginalError())
+		}
+	}
+	return result
+}
+
+// errorExtensions digs the extensions out of an error that graphql-go wrapped without
+// keeping them, as it does for errors returned by thunks.
+func errorExtensions(err error) map[string]interface{} {
+	for err != nil {
+		switch wrapped := err.(type) {
+		case gqlerrors.ExtendedError:
+			return wrapped.Extensions()
+		case gqlerrors.FormattedError:
+			err = wrapped.OriginalError()
+		case *gqlerrors.Error:
+			err = wrapped.OriginalError
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// graphqlParamsFromQuery reads an operation from the query string of a GET request.
+func graphqlParamsFromQuery(c *gin.Context) (operationParams, error) {
+	params := operationParams{
+		Query:         c.Query("query"),
+		OperationName: c.Query("operationName"),
+	}
+
+	if variables := c.Query("variables"); variables != "" {
+		if err := json.Unmarshal([]byte(variables), &params.Variables); err != nil {
+			return params, errors.New("Variables must be a JSON object")
+		}
+	}
+	if extensions := c.Query("extensions"); extensions != "" {
+		if err := json.Unmarshal([]byte(extensions), &params.Extensions); err != nil {
+			return params, errors.New("Extensions must be a JSON object")
+		}
+	}
+	return params, nil
+}
+
+// operationType returns the type of the operation that will be executed, or an
+// empty string when the document cannot be parsed; execution reports that error.
+func operationType(params operationParams) string {
+	document, err := parser.Parse(parser.ParseParams{Source: params.Query})
+	if err != nil {
+		return ""
+	}
+
+	if operation := findOperation(document, params.OperationName); operation != nil {
+		return operation.Operation
+	}
+	return ""
+}
+
+// writeResult answers per the GraphQL-over-HTTP spec. Clients accepting
+// application/graphql-response+json get 400 when the request failed before execution
+// (no data); legacy application/json clients always get 200 for a well-formed request.
+func writeResult(c *gin.Context, result *graphql.Result) {
+	status := http.StatusOK
+	if acceptsGraphQLResponse(c) && result.Data == nil && len(result.Errors) > 0 {
+		status = http.StatusBadRequest
+	}
+	writeJSON(c, status, result)
+}
+
+// writeRequestError answers a request that is not a well-formed GraphQL request.
+func writeRequestError(c *gin.Context, message string) {
+	writeError(c, http.StatusBadRequest, message)
+}
+
+func writeError(c *gin.Context, status int, message string) {
+	writeJSON(c, status, &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(message)}})
+	c.Abort()
+}
+
+func writeJSON(c *gin.Context, status int, body interface{}) {
+	if acceptsGraphQLResponse(c) {
+		c.Header("Content-Type", responseContentType)
+	}
+	c.JSON(status, body)
+}
+
+func acceptsGraphQLResponse(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), responseContentType)
+}
+
+// scopedService scopes the person service to the actor of the GraphQL request being resolved.
+func scopedService(p graphql.ResolveParams, personService service.PersonService) service.PersonService {
+	return personService.WithOrigin(requestInfoFrom(p).Origin)
+}
+
+func requestInfoFrom(p graphql.ResolveParams) requestInfo {
+	request, _ := p.Context.Value(requestInfoKey{}).(requestInfo)
+	return request
+}
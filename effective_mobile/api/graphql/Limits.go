@@ -0,0 +1,287 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// defaultListSize is the number of items assumed for a list field without a page size argument.
+const defaultListSize = 10
+
+// Limits bounds the work a single GraphQL operation may cause.
+type Limits struct {
+	MaxDepth int
+	MaxCost  int
+	Timeout  time.Duration
+}
+
+// checkLimits measures the operation and returns an error when it is deeper or
+// more expensive than allowed, or when its fragments cannot be measured. Introspection
+// fields are not counted.
+func checkLimits(schema graphql.Schema, document *ast.Document, params operationParams, limits Limits) *gqlerrors.FormattedError {
+	if err := checkFragments(document); err != nil {
+		return err
+	}
+
+	operation := findOperation(document, params.OperationName)
+	if operation == nil {
+		return nil
+	}
+
+	var rootType *graphql.Object
+	switch operation.Operation {
+	case ast.OperationTypeMutation:
+		rootType = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		rootType = schema.SubscriptionType()
+	default:
+		rootType = schema.QueryType()
+	}
+	if rootType == nil {
+		return nil
+	}
+
+	analyzer := &queryAnalyzer{
+		schema:    schema,
+		variables: params.Variables,
+		fragments: make(map[string]*ast.FragmentDefinition),
+	}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			analyzer.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	depth, cost := analyzer.measure(operation.SelectionSet, rootType, 1, map[string]bool{})
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return codedError(fmt.Sprintf("Query depth %d exceeds the maximum of %d", depth, limits.MaxDepth), "QUERY_TOO_DEEP")
+	}
+	if limits.MaxCost > 0 && cost > limits.MaxCost {
+		return codedError(fmt.Sprintf("Query cost %d exceeds the maximum of %d", cost, limits.MaxCost), "QUERY_TOO_COMPLEX")
+	}
+	return nil
+}
+
+// checkFragments rejects documents spreading unknown fragments or fragments that spread
+// themselves, in any of their definitions and whether or not the operation uses them.
+// The validation of graphql-go recurses through such cycles until the stack overflows,
+// which cannot be recovered from, so they must never reach it.
+func checkFragments(document *ast.Document) *gqlerrors.FormattedError {
+	spreads := make(map[string][]string)
+	var operationSpreads []string
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			name := definition.Name.Value
+			spreads[name] = append(spreads[name], fragmentSpreads(definition.SelectionSet, nil)...)
+		case *ast.OperationDefinition:
+			operationSpreads = fragmentSpreads(definition.SelectionSet, operationSpreads)
+		}
+	}
+
+	for _, name := range operationSpreads {
+		if _, ok := spreads[name]; !ok {
+			return codedError(fmt.Sprintf("Unknown fragment %s", name), "UNKNOWN_FRAGMENT")
+		}
+	}
+
+	// Depth-first search, where visiting marks the fragments on the current path
+	const visiting, visited = 1, 2
+	state := make(map[string]int)
+	var visit func(name string) *gqlerrors.FormattedError
+	visit = func(name string) *gqlerrors.FormattedError {
+		state[name] = visiting
+		for _, spread := range spreads[name] {
+			if _, ok := spreads[spread]; !ok {
+				return codedError(fmt.Sprintf("Unknown fragment %s", spread), "UNKNOWN_FRAGMENT")
+			}
+			switch state[spread] {
+			case visiting:
+				return codedError(fmt.Sprintf("Fragment %s spreads itself", spread), "FRAGMENT_CYCLE")
+			case 0:
+				if err := visit(spread); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for name := range spreads {
+		if state[name] == 0 {
+			if err := visit(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fragmentSpreads appends the names of the fragments spread in a selection set, at
+// any depth, to names.
+func fragmentSpreads(selectionSet *ast.SelectionSet, names []string) []string {
+	if selectionSet == nil {
+		return names
+	}
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			names = fragmentSpreads(selection.SelectionSet, names)
+		case *ast.InlineFragment:
+			names = fragmentSpreads(selection.SelectionSet, names)
+		case *ast.FragmentSpread:
+			names = append(names, selection.Name.Value)
+		}
+	}
+	return names
+}
+
+func codedError(message, code string) *gqlerrors.FormattedError {
+	err := gqlerrors.NewFormattedError(message)
+	err.Extensions = map[string]interface{}{"code": code}
+	return &err
+}
+
+type queryAnalyzer struct {
+	schema    graphql.Schema
+	variables map[string]interface{}
+	fragments map[string]*ast.FragmentDefinition
+}
+
+// measure returns the depth and cost of a selection set. Every field costs 1 plus the
+// cost of its selections, multiplied by the requested page size for list fields.
+func (a *queryAnalyzer) measure(selectionSet *ast.SelectionSet, parentType graphql.Type, depth int, visitedFragments map[string]bool) (int, int) {
+	if selectionSet == nil {
+		return 0, 0
+	}
+
+	maxDepth, cost := 0, 0
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+
+			fieldType, isList := a.fieldType(parentType, selection.Name.Value)
+			childDepth, childCost := a.measure(selection.SelectionSet, fieldType, depth+1, visitedFragments)
+			if isList {
+				childCost *= a.listSize(selection)
+			}
+
+			maxDepth = max(maxDepth, depth, childDepth)
+			cost += 1 + childCost
+		case *ast.InlineFragment:
+			fragmentType := parentType
+			if selection.TypeCondition != nil {
+				fragmentType = a.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			childDepth, childCost := a.measure(selection.SelectionSet, fragmentType, depth, visitedFragments)
+			maxDepth = max(maxDepth, childDepth)
+			cost += childCost
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := a.fragments[name]
+			if !ok || visitedFragments[name] {
+				continue
+			}
+			visitedFragments[name] = true
+			childDepth, childCost := a.measure(fragment.SelectionSet, a.schema.Type(fragment.TypeCondition.Name.Value), depth, visitedFragments)
+			delete(visitedFragments, name)
+			maxDepth = max(maxDepth, childDepth)
+			cost += childCost
+		}
+	}
+	return maxDepth, cost
+}
+
+// fieldType returns the named type of a field and whether the field is a list.
+func (a *queryAnalyzer) fieldType(parentType graphql.Type, fieldName string) (graphql.Type, bool) {
+	var fields graphql.FieldDefinitionMap
+	switch parentType := parentType.(type) {
+	case *graphql.Object:
+		fields = parentType.Fields()
+	case *graphql.Interface:
+		fields = parentType.Fields()
+	default:
+		return nil, false
+	}
+
+	field, ok := fields[fieldName]
+	if !ok {
+		return nil, false
+	}
+
+	fieldType, isList := field.Type, false
+	for {
+		switch wrapped := fieldType.(type) {
+		case *graphql.NonNull:
+			fieldType = wrapped.OfType
+		case *graphql.List:
+			fieldType, isList = wrapped.OfType, true
+		default:
+			return fieldType, isList
+		}
+	}
+}
+
+// listSize returns the page size a list field asks for: its first, limit or pageSize
+// argument, or the number of ids requested, falling back to defaultListSize.
+func (a *queryAnalyzer) listSize(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		switch argument.Name.Value {
+		case "first", "limit", "pageSize":
+			if size, ok := a.intValue(argument.Value); ok && size > 0 {
+				return size
+			}
+		case "ids":
+			if size, ok := a.listLength(argument.Value); ok {
+				return max(size, 1)
+			}
+		}
+	}
+	return defaultListSize
+}
+
+func (a *queryAnalyzer) intValue(value ast.Value) (int, bool) {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		size, err := strconv.Atoi(value.Value)
+		return size, err == nil
+	case *ast.Variable:
+		size, ok := a.variables[value.Name.Value].(float64)
+		return int(size), ok
+	}
+	return 0, false
+}
+
+func (a *queryAnalyzer) listLength(value ast.Value) (int, bool) {
+	switch value := value.(type) {
+	case *ast.ListValue:
+		return len(value.Values), true
+	case *ast.Variable:
+		list, ok := a.variables[value.Name.Value].([]interface{})
+		return len(list), ok
+	}
+	return 0, false
+}
+
+// findOperation returns the operation that will be executed for the given operation name.
+func findOperation(document *ast.Document, operationName string) *ast.OperationDefinition {
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (operation.Name != nil && operation.Name.Value == operationName) {
+			return operation
+		}
+	}
+	return nil
+}
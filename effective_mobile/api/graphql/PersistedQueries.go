@@ -0,0 +1,105 @@
+package graphql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// maxPersistedQueries bounds how many queries clients can register at runtime.
+const maxPersistedQueries = 1000
+
+// PersistedQueries implements Apollo automatic persisted queries. In locked mode only
+// the queries of the allow-list run, so production clients are limited to known operations.
+type PersistedQueries struct {
+	mu      sync.RWMutex
+	queries map[string]string
+	locked  bool
+}
+
+// LoadPersistedQueries reads an allow-list of queries keyed by their SHA-256 hash from a
+// JSON file. An empty path starts with no queries.
+func LoadPersistedQueries(path string, locked bool) (*PersistedQueries, error) {
+	persisted := &PersistedQueries{queries: make(map[string]string), locked: locked}
+	if path == "" {
+		return persisted, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &persisted.queries); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for hash, query := range persisted.queries {
+		if queryHash(query) != hash {
+			return nil, fmt.Errorf("persisted query %s does not match its hash", hash)
+		}
+	}
+	return persisted, nil
+}
+
+// resolve fills in the query of a request that only sends its hash and registers new
+// queries, returning the error to answer with when the request cannot be served.
+func (p *PersistedQueries) resolve(params *operationParams) *gqlerrors.FormattedError {
+	hash := persistedQueryHash(params.Extensions)
+	if hash == "" {
+		if p.locked && params.Query != "" {
+			return codedError("Only persisted queries are allowed", "PERSISTED_QUERY_REQUIRED")
+		}
+		return nil
+	}
+
+	if params.Query == "" {
+		p.mu.RLock()
+		query, ok := p.queries[hash]
+		p.mu.RUnlock()
+		if !ok {
+			return codedError("PersistedQueryNotFound", "PERSISTED_QUERY_NOT_FOUND")
+		}
+		params.Query = query
+		return nil
+	}
+
+	if queryHash(params.Query) != hash {
+		return codedError("provided sha does not match query", "PERSISTED_QUERY_HASH_MISMATCH")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.queries[hash]; ok {
+		return nil
+	}
+	if p.locked {
+		return codedError("Query is not in the persisted query allow-list", "PERSISTED_QUERY_NOT_ALLOWED")
+	}
+	if len(p.queries) < maxPersistedQueries {
+		p.queries[hash] = params.Query
+	}
+	return nil
+}
+
+// persistedQueryHash returns extensions.persistedQuery.sha256Hash of a version 1 request.
+func persistedQueryHash(extensions map[string]interface{}) string {
+	persistedQuery, ok := extensions["persistedQuery"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if version, _ := persistedQuery["version"].(float64); version != 1 {
+		return ""
+	}
+	hash, _ := persistedQuery["sha256Hash"].(string)
+	return hash
+}
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,431 @@
+package graphql
+
+import (
+	"github.com/graphql-go/graphql"
+
+	"effective_mobile/apperrors"
+	"effective_mobile/dataloader"
+	"effective_mobile/entities"
+	"effective_mobile/events"
+	"effective_mobile/service"
+)
+
+// NewSchema builds the GraphQL schema resolving against personService. The types are
+// built per schema so that schemas for different services do not share resolvers.
+func NewSchema(personService service.PersonService) (graphql.Schema, error) {
+	attributeProvenanceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AttributeProvenance",
+		Fields: graphql.Fields{
+			"source": &graphql.Field{
+				Type: graphql.String,
+			},
+			"provider": &graphql.Field{
+				Type: graphql.String,
+			},
+			"confidence": &graphql.Field{
+				Type: graphql.Float,
+			},
+			"enrichedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	})
+	provenanceFields := graphql.Fields{}
+	for _, attribute := range entities.Attributes {
+		attribute := attribute
+		provenanceFields[attribute] = &graphql.Field{
+			Type: attributeProvenanceType,
+			// Null when the provenance is unknown
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				provenance, _ := p.Source.(entities.Provenance)
+				if attributeProvenance := provenance.Get(attribute); attributeProvenance != (entities.AttributeProvenance{}) {
+					return attributeProvenance, nil
+				}
+				return nil, nil
+			},
+		}
+	}
+	provenanceType := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Provenance",
+		Fields: provenanceFields,
+	})
+
+	personType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Person",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"name": &graphql.Field{
+				Type: graphql.String,
+			},
+			"surname": &graphql.Field{
+				Type: graphql.String,
+			},
+			"patronymic": &graphql.Field{
+				Type: graphql.String,
+			},
+			"age": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"gender": &graphql.Field{
+				Type: graphql.String,
+			},
+			"nationality": &graphql.Field{
+				Type: graphql.String,
+			},
+			"countryId": &graphql.Field{
+				Type: graphql.String,
+				// Null when no country hint was given
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if person, ok := p.Source.(*entities.Person); ok && person.CountryID != "" {
+						return person.CountryID, nil
+					}
+					return nil, nil
+				},
+			},
+			"enrichmentSource": &graphql.Field{
+				Type: graphql.String,
+				// Null when the attributes were entered by hand
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if person, ok := p.Source.(*entities.Person); ok && person.EnrichmentSource != "" {
+						return person.EnrichmentSource, nil
+					}
+					return nil, nil
+				},
+			},
+			"provenance": &graphql.Field{
+				Type: provenanceType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if person, ok := p.Source.(*entities.Person); ok {
+						return person.Provenance, nil
+					}
+					return nil, nil
+				},
+			},
+			"enrichmentStatus": &graphql.Field{
+				Type: graphql.String,
+				// Null for people enriched before they were stored
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if person, ok := p.Source.(*entities.Person); ok && person.EnrichmentStatus != "" {
+						return person.EnrichmentStatus, nil
+					}
+					return nil, nil
+				},
+			},
+			"deletedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	})
+	personHistoryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PersonHistory",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"personId": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"action": &graphql.Field{
+				Type: graphql.String,
+			},
+			"before": &graphql.Field{
+				Type: personType,
+			},
+			"after": &graphql.Field{
+				Type: personType,
+			},
+			"actor": &graphql.Field{
+				Type: graphql.String,
+			},
+			"source": &graphql.Field{
+				Type: graphql.String,
+			},
+			"changedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	})
+
+	personType.AddFieldConfig("history", &graphql.Field{
+		Type: graphql.NewList(personHistoryType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			person, _ := p.Source.(*entities.Person)
+			if person == nil {
+				return nil, nil
+			}
+			history, err := personService.GetPersonHistory(person.ID)
+			return history, apperrors.GraphQLError(err)
+		},
+	})
+
+	var queryType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"person": &graphql.Field{
+				Type: personType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.Int,
+					},
+					"includeDeleted": &graphql.ArgumentConfig{
+						Type:         graphql.Boolean,
+						DefaultValue: false,
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, _ := p.Args["id"].(int)
+					includeDeleted, _ := p.Args["includeDeleted"].(bool)
+					if includeDeleted {
+						if !requestInfoFrom(p).Admin {
+							return nil, apperrors.GraphQLError(apperrors.Forbidden("includeDeleted requires admin access"))
+						}
+						person, err := personService.GetPersonByIDIncludingDeleted(id)
+						return person, apperrors.GraphQLError(err)
+					}
+					load := personLoaderFrom(p, personService).Load(id)
+					return func() (interface{}, error) {
+						person, err := load()
+						return person, apperrors.GraphQLError(err)
+					}, nil
+				},
+			},
+			"people": &graphql.Field{
+				Type: graphql.NewList(personType),
+				Args: graphql.FieldConfigArgument{
+					"ids": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.Int))),
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					args, _ := p.Args["ids"].([]interface{})
+					ids := make([]int, len(args))
+					for i, id := range args {
+						ids[i] = id.(int)
+					}
+					load := personLoaderFrom(p, personService).LoadMany(ids)
+					return func() (interface{}, error) {
+						people, err := load()
+						return people, apperrors.GraphQLError(err)
+					}, nil
+				},
+			},
+		},
+	})
+
+	var mutationType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createPerson": &graphql.Field{
+				Type: personType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"surname": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"patronymic": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					"age": &graphql.ArgumentConfig{
+						Type: graphql.Int,
+					},
+					"gender": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					"nationality": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					// ISO 3166-1 alpha-2 country localizing the age and gender estimates
+					"countryId": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					"enrich": &graphql.ArgumentConfig{
+						Type:         graphql.Boolean,
+						DefaultValue: true,
+					},
+					"skipProviders": &graphql.ArgumentConfig{
+						Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					name, _ := p.Args["name"].(string)
+					surname, _ := p.Args["surname"].(string)
+					patronymic, _ := p.Args["patronymic"].(string)
+					age, _ := p.Args["age"].(int)
+					gender, _ := p.Args["gender"].(string)
+					nationality, _ := p.Args["nationality"].(string)
+					countryID, _ := p.Args["countryId"].(string)
+					newPerson := &entities.Person{
+						Name:        name,
+						Surname:     surname,
+						Patronymic:  patronymic,
+						Age:         age,
+						Gender:      gender,
+						Nationality: nationality,
+						CountryID:   countryID,
+					}
+					enrich, _ := p.Args["enrich"].(bool)
+					options := service.EnrichOptions{Enrich: enrich}
+					skipProviders, _ := p.Args["skipProviders"].([]interface{})
+					for _, provider := range skipProviders {
+						options.SkipProviders = append(options.SkipProviders, provider.(string))
+					}
+					createdPerson, err := scopedService(p, personService).CreatePersonWithEnrichment(newPerson, options)
+					return createdPerson, apperrors.GraphQLError(err)
+				},
+			},
+			"updatePerson": &graphql.Field{
+				Type: personType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.Int),
+					},
+					"name": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					"surname": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					"patronymic": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, _ := p.Args["id"].(int)
+					updatedPerson, err := personService.GetPersonByID(id)
+					if err != nil {
+						return nil, apperrors.GraphQLError(err)
+					}
+					// Only the arguments that were passed are changed
+					if name, ok := p.Args["name"].(string); ok {
+						updatedPerson.Name = name
+					}
+					if surname, ok := p.Args["surname"].(string); ok {
+						updatedPerson.Surname = surname
+					}
+					if patronymic, ok := p.Args["patronymic"].(string); ok {
+						updatedPerson.Patronymic = patronymic
+					}
+					updatedPerson, err = scopedService(p, personService).UpdatePerson(updatedPerson)
+					return updatedPerson, apperrors.GraphQLError(err)
+				},
+			},
+			"deletePerson": &graphql.Field{
+				Type: graphql.Boolean,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.Int),
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, _ := p.Args["id"].(int)
+					if err := scopedService(p, personService).DeletePerson(id); err != nil {
+						return false, apperrors.GraphQLError(err)
+					}
+					return true, nil
+				},
+			},
+			"restorePerson": &graphql.Field{
+				Type: personType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.Int),
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, _ := p.Args["id"].(int)
+					restoredPerson, err := scopedService(p, personService).RestorePerson(id)
+					return restoredPerson, apperrors.GraphQLError(err)
+				},
+			},
+		},
+	})
+
+	var subscriptionType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"personCreated": personEventField(personType, personService, events.PersonCreated),
+			"personUpdated": personEventField(personType, personService, events.PersonUpdated),
+			"personDeleted": personEventField(personType, personService, events.PersonDeleted),
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        queryType,
+		Mutation:     mutationType, // Add mutation type
+		Subscription: subscriptionType,
+	})
+}
+
+// personEventField is a subscription field streaming people from events of the
+// given type, optionally filtered by id, name and nationality.
+func personEventField(personType *graphql.Object, personService service.PersonService, eventType string) *graphql.Field {
+	return &graphql.Field{
+		Type: personType,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{
+				Type: graphql.Int,
+			},
+			"name": &graphql.ArgumentConfig{
+				Type: graphql.String,
+			},
+			"nationality": &graphql.ArgumentConfig{
+				Type: graphql.String,
+			},
+		},
+		Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+			personEvents, unsubscribe := personService.SubscribeEvents(16)
+			people := make(chan interface{})
+
+			go func() {
+				defer unsubscribe()
+				defer close(people)
+				for {
+					select {
+					case <-p.Context.Done():
+						return
+					case event := <-personEvents:
+						if event.Type != eventType || !matchesPersonFilter(event.Person, p.Args) {
+							continue
+						}
+						select {
+						case people <- event.Person:
+						case <-p.Context.Done():
+							return
+						}
+					}
+				}
+			}()
+
+			return people, nil
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source, nil
+		},
+	}
+}
+
+// personLoaderFrom returns the person loader of the operation being resolved. Outside
+// of one, e.g. for subscription events, lookups go through a loader of their own.
+func personLoaderFrom(p graphql.ResolveParams, personService service.PersonService) *dataloader.PersonLoader {
+	if loader, ok := p.Context.Value(personLoaderKey{}).(*dataloader.PersonLoader); ok {
+		return loader
+	}
+	return dataloader.NewPersonLoader(personService.GetPeopleByIDs)
+}
+
+func matchesPersonFilter(person *entities.Person, args map[string]interface{}) bool {
+	if id, ok := args["id"].(int); ok && person.ID != id {
+		return false
+	}
+	if name, ok := args["name"].(string); ok && person.Name != name {
+		return false
+	}
+	if nationality, ok := args["nationality"].(string); ok && person.Nationality != nationality {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,293 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// graphqlTransportWS is the subprotocol of https://github.com/enisdenjo/graphql-ws.
+const graphqlTransportWS = "graphql-transport-ws"
+
+const connectionInitTimeout = 10 * time.Second
+
+// Close codes defined by the graphql-transport-ws protocol.
+const (
+	closeBadRequest          = 4400
+	closeUnauthorized        = 4401
+	closeInitTimeout         = 4408
+	closeSubscriberExists    = 4409
+	closeTooManyInitRequests = 4429
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsSession is one graphql-transport-ws connection and the operations running on it.
+type wsSession struct {
+	conn   *websocket.Conn
+	server *Server
+	ctx    context.Context
+
+	writeMu sync.Mutex
+
+	mu         sync.Mutex
+	acked      bool
+	operations map[string]context.CancelFunc
+}
+
+// serveWebSocket upgrades the request and runs the session until the client disconnects.
+func serveWebSocket(w http.ResponseWriter, r *http.Request, server *Server, ctx context.Context) {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{graphqlTransportWS},
+		CheckOrigin:  server.checkOrigin,
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("Error upgrading GraphQL WebSocket: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	session := &wsSession{
+		conn:       conn,
+		server:     server,
+		ctx:        ctx,
+		operations: make(map[string]context.CancelFunc),
+	}
+	session.run()
+
+	// Stop the running operations before closing so they do not write to a closed connection.
+	cancel()
+	conn.Close()
+}
+
+func (s *wsSession) run() {
+	if s.conn.Subprotocol() != graphqlTransportWS {
+		s.close(websocket.CloseProtocolError, "Unsupported subprotocol")
+		return
+	}
+
+	initTimer := time.AfterFunc(connectionInitTimeout, func() {
+		s.mu.Lock()
+		acked := s.acked
+		s.mu.Unlock()
+		if !acked {
+			s.close(closeInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var message wsMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			s.close(closeBadRequest, "Invalid message received")
+			return
+		}
+
+		switch message.Type {
+		case "connection_init":
+			s.mu.Lock()
+			alreadyAcked := s.acked
+			s.acked = true
+			s.mu.Unlock()
+			if alreadyAcked {
+				s.close(closeTooManyInitRequests, "Too many initialisation requests")
+				return
+			}
+			s.write(wsMessage{Type: "connection_ack"})
+		case "ping":
+			s.write(wsMessage{Type: "pong"})
+		case "pong":
+		case "subscribe":
+			if !s.subscribe(message) {
+				return
+			}
+		case "complete":
+			s.cancel(message.ID)
+		default:
+			s.close(closeBadRequest, "Unknown message type "+message.Type)
+			return
+		}
+	}
+}
+
+// subscribe starts an operation, reporting false when the connection was closed.
+func (s *wsSession) subscribe(message wsMessage) bool {
+	var params operationParams
+	if message.ID == "" || json.Unmarshal(message.Payload, &params) != nil {
+		s.close(closeBadRequest, "Invalid subscribe message")
+		return false
+	}
+
+	s.mu.Lock()
+	if !s.acked {
+		s.mu.Unlock()
+		s.close(closeUnauthorized, "Unauthorized")
+		return false
+	}
+	if _, exists := s.operations[message.ID]; exists {
+		s.mu.Unlock()
+		s.close(closeSubscriberExists, "Subscriber for "+message.ID+" already exists")
+		return false
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.operations[message.ID] = cancel
+	s.mu.Unlock()
+
+	go s.execute(ctx, message.ID, params)
+	return true
+}
+
+func (s *wsSession) execute(ctx context.Context, id string, params operationParams) {
+	var errs []gqlerrors.FormattedError
+	if result := s.server.prepare(&params); result != nil {
+		errs = result.Errors
+	} else {
+		errs = validate(s.server.schema, params)
+	}
+	if len(errs) > 0 {
+		if s.finish(id) {
+			s.writePayload("error", id, errs)
+		}
+		return
+	}
+
+	// Browsers send the cookies of any site opening a WebSocket, so changes are kept to POST
+	if operationType(params) == ast.OperationTypeMutation {
+		if s.finish(id) {
+			s.writePayload("error", id, gqlerrors.FormatErrors(errors.New("Mutations are only allowed over POST")))
+		}
+		return
+	}
+
+	if operationType(params) != ast.OperationTypeSubscription {
+		result := s.server.run(ctx, params)
+		if s.finish(id) {
+			s.writePayload("next", id, result)
+			s.write(wsMessage{ID: id, Type: "complete"})
+		}
+		return
+	}
+
+	results := graphql.Subscribe(graphql.Params{
+		Schema:         s.server.schema,
+		RequestString:  params.Query,
+		VariableValues: params.Variables,
+		OperationName:  params.OperationName,
+		Context:        ctx,
+	})
+	// Keep draining after cancellation so the executor can observe it and stop.
+	for result := range results {
+		if ctx.Err() == nil {
+			s.writePayload("next", id, result)
+		}
+	}
+
+	if s.finish(id) {
+		s.write(wsMessage{ID: id, Type: "complete"})
+	}
+}
+
+// finish forgets an operation, reporting whether it was still running, i.e. not completed by the client.
+func (s *wsSession) finish(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancel, running := s.operations[id]
+	if running {
+		cancel()
+		delete(s.operations, id)
+	}
+	return running && s.ctx.Err() == nil
+}
+
+func (s *wsSession) cancel(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cancel, ok := s.operations[id]; ok {
+		cancel()
+		delete(s.operations, id)
+	}
+}
+
+func (s *wsSession) writePayload(messageType, id string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("Error encoding GraphQL WebSocket payload: %v\n", err)
+		return
+	}
+	s.write(wsMessage{ID: id, Type: messageType, Payload: data})
+}
+
+func (s *wsSession) write(message wsMessage) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.conn.WriteJSON(message); err != nil {
+		fmt.Printf("Error writing GraphQL WebSocket message: %v\n", err)
+	}
+}
+
+func (s *wsSession) close(code int, reason string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	s.conn.Close()
+}
+
+// checkOrigin lets clients without an Origin header, which are not browsers, connect,
+// as well as pages served from the host of the request or from an allowed origin.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.allowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate parses and validates an operation without executing it.
+func validate(schema graphql.Schema, params operationParams) []gqlerrors.FormattedError {
+	document, err := parser.Parse(parser.ParseParams{Source: params.Query})
+	if err != nil {
+		return gqlerrors.FormatErrors(err)
+	}
+
+	validation := graphql.ValidateDocument(&schema, document, nil)
+	if !validation.IsValid {
+		return validation.Errors
+	}
+	return nil
+}
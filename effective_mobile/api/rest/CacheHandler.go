@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"effective_mobile/api/auth"
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/problem"
+	"effective_mobile/service"
+)
+
+// warmWorkers is how many names are enriched at once when warming the cache.
+const warmWorkers = 4
+
+// CacheHandler serves the admin API of the enrichment cache.
+type CacheHandler struct {
+	personService service.PersonService
+	enricher      *enrichment.APIEnricher
+	adminToken    string
+}
+
+// NewCacheHandler builds the cache admin handlers, which answer 403 unless the request
+// carries adminToken in the X-Admin-Token header.
+func NewCacheHandler(personService service.PersonService, enricher *enrichment.APIEnricher, adminToken string) *CacheHandler {
+	return &CacheHandler{personService: personService, enricher: enricher, adminToken: adminToken}
+}
+
+// Register mounts the cache admin routes on the router.
+func (h *CacheHandler) Register(router gin.IRoutes) {
+	router.GET("/api/admin/cache/enrichment/:name", h.requireAdmin, h.inspect)
+	router.DELETE("/api/admin/cache/enrichment/:name", h.requireAdmin, h.evict)
+	router.DELETE("/api/admin/cache/enrichment", h.requireAdmin, h.evictMatching)
+	router.POST("/api/admin/cache/enrichment/warm", h.requireAdmin, h.warm)
+	router.GET("/api/admin/enrichment/quota", h.requireAdmin, h.quota)
+}
+
+func (h *CacheHandler) requireAdmin(c *gin.Context) {
+	if !auth.IsAdmin(c, h.adminToken) {
+		respondWithError(c, apperrors.Forbidden("The cache admin API requires admin access"))
+		c.Abort()
+	}
+}
+
+// inspect shows what is cached for a name. Without a country query parameter, it
+// shows the global results and lists the countries results are localized to.
+func (h *CacheHandler) inspect(c *gin.Context) {
+	name, ok := cacheName(c)
+	if !ok {
+		return
+	}
+	entry, found, err := h.enricher.Cache().Inspect(c.Request.Context(), name)
+	if err != nil {
+		respondWithError(c, apperrors.Upstream(err, "Failed to read the enrichment cache"))
+		return
+	}
+
+	response := gin.H{
+		"name":       c.Param("name"),
+		"key":        h.enricher.Cache().Key(name),
+		"attributes": entry.Attributes,
+	}
+	if c.Query("country") == "" {
+		countries, err := h.enricher.Cache().Countries(c.Request.Context(), name)
+		if err != nil {
+			respondWithError(c, apperrors.Upstream(err, "Failed to read the enrichment cache"))
+			return
+		}
+		found = found || len(countries) > 0
+		response["countries"] = countries
+	}
+	if !found {
+		respondWithError(c, apperrors.NotFound("Nothing is cached for %s", name))
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// evict drops everything cached for a name, or only its results localized to the
+// country query parameter.
+func (h *CacheHandler) evict(c *gin.Context) {
+	name, ok := cacheName(c)
+	if !ok {
+		return
+	}
+	if err := h.enricher.Cache().Evict(c.Request.Context(), name); err != nil {
+		respondWithError(c, apperrors.Upstream(err, "Failed to evict from the enrichment cache"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// cacheName returns the cache name of the name parameter, localized to the country
+// query parameter when one is given.
+func cacheName(c *gin.Context) (string, bool) {
+	name := c.Param("name")
+	country := c.Query("country")
+	if country == "" {
+		return name, true
+	}
+	countryID := enrichment.NormalizeCountryID(country)
+	if !enrichment.ValidCountryID(countryID) {
+		respondWithError(c, apperrors.InvalidFields(map[string]string{"country": "Country must be a two-letter ISO 3166-1 code"}))
+		return "", false
+	}
+	return enrichment.CacheName(name, countryID), true
+}
+
+// evictMatching drops the names matching the pattern query parameter, or only the
+// attribute given by the attribute parameter. One of them is required so that the
+// whole cache is not flushed by accident.
+func (h *CacheHandler) evictMatching(c *gin.Context) {
+	pattern := c.DefaultQuery("pattern", "*")
+	attribute := c.Query("attribute")
+	if c.Query("pattern") == "" && attribute == "" {
+		respondWithError(c, apperrors.InvalidFields(map[string]string{"pattern": "A pattern or an attribute is required"}))
+		return
+	}
+
+	provider := ""
+	if attribute != "" {
+		var ok bool
+		if provider, ok = enrichment.AttributeProviders[attribute]; !ok {
+			respondWithError(c, apperrors.InvalidFields(map[string]string{"attribute": "Unknown attribute " + attribute}))
+			return
+		}
+	}
+
+	evicted, err := h.enricher.Cache().EvictMatching(c.Request.Context(), pattern, provider)
+	if err != nil {
+		respondWithError(c, apperrors.Upstream(err, "Failed to evict from the enrichment cache"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"evicted": evicted})
+}
+
+type warmRequest struct {
+	Names []string `json:"names"`
+	// FromPeople warms the names of every live person as well.
+	FromPeople bool `json:"fromPeople"`
+}
+
+func (h *CacheHandler) warm(c *gin.Context) {
+	var request warmRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, "Invalid JSON format"))
+		return
+	}
+
+	names := request.Names
+	if request.FromPeople {
+		personNames, err := h.personService.GetDistinctNames()
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		names = append(names, personNames...)
+	}
+	if len(names) == 0 {
+		respondWithError(c, apperrors.InvalidFields(map[string]string{"names": "Names or fromPeople are required"}))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.enricher.Warm(names, warmWorkers))
+}
+
+// quota shows the quota each provider reported last; providers that reported none are left out.
+func (h *CacheHandler) quota(c *gin.Context) {
+	quotas := gin.H{}
+	for _, provider := range enrichment.Providers {
+		if quota, ok := h.enricher.Quotas().Get(c.Request.Context(), provider); ok {
+			quotas[provider] = gin.H{
+				"limit":     quota.Limit,
+				"remaining": quota.Remaining,
+				"resetAt":   quota.ResetAt,
+				"exhausted": quota.Exhausted(),
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, quotas)
+}
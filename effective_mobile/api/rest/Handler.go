@@ -0,0 +1,280 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"effective_mobile/api/auth"
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"effective_mobile/problem"
+	"effective_mobile/service"
+)
+
+// Handler serves the people REST API.
+type Handler struct {
+	personService service.PersonService
+	adminToken    string
+}
+
+// NewHandler builds the REST handlers. Requests carrying adminToken in the
+// X-Admin-Token header get admin-only features; an empty token disables them.
+func NewHandler(personService service.PersonService, adminToken string) *Handler {
+	return &Handler{personService: personService, adminToken: adminToken}
+}
+
+// Register mounts the REST routes on the router.
+func (h *Handler) Register(router gin.IRoutes) {
+	router.POST("/api/people", h.createPerson)
+	router.GET("/api/people/:id", h.getPerson)
+	router.PUT("/api/people/:id", h.updatePerson)
+	router.DELETE("/api/people/:id", h.deletePerson)
+	router.POST("/api/people/:id/restore", h.restorePerson)
+	router.GET("/api/people/:id/history", h.getPersonHistory)
+	router.GET("/api/people/:id/enrichment", h.getEnrichmentProgress)
+	router.POST("/api/admin/re-enrichment", h.reEnrich)
+}
+
+func (h *Handler) createPerson(c *gin.Context) {
+	var inputPerson entities.Person
+	if err := c.ShouldBindJSON(&inputPerson); err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, "Invalid JSON format"))
+		return
+	}
+
+	options := service.EnrichOptions{
+		Enrich:        c.DefaultQuery("enrich", "true") != "false",
+		SkipProviders: splitList(c.Query("skipProviders")),
+	}
+
+	// The person is stored right away and enriched in the background
+	if options.Enrich && c.Query("async") == "true" {
+		createdPerson, err := h.service(c).CreatePersonAsync(&inputPerson, options, c.Query("webhook"))
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		c.Header("Location", fmt.Sprintf("/api/people/%d", createdPerson.ID))
+		c.JSON(http.StatusAccepted, createdPerson)
+		return
+	}
+
+	createdPerson, err := h.service(c).CreatePersonWithEnrichment(&inputPerson, options)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, createdPerson)
+}
+
+func (h *Handler) getPerson(c *gin.Context) {
+	personIDInt, ok := parsePersonID(c)
+	if !ok {
+		return
+	}
+
+	getPerson := h.personService.GetPersonByID
+	if c.Query("includeDeleted") == "true" {
+		if !auth.IsAdmin(c, h.adminToken) {
+			respondWithError(c, apperrors.Forbidden("includeDeleted requires admin access"))
+			return
+		}
+		getPerson = h.personService.GetPersonByIDIncludingDeleted
+	}
+
+	person, err := getPerson(personIDInt)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, person)
+}
+
+func (h *Handler) updatePerson(c *gin.Context) {
+	// Parse the person ID from the request URL
+	personIDInt, ok := parsePersonID(c)
+	if !ok {
+		return
+	}
+
+	var updatedPersonData entities.Person
+	if err := c.ShouldBindJSON(&updatedPersonData); err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, "Invalid JSON format"))
+		return
+	}
+
+	updatedPerson := &entities.Person{
+		ID:          personIDInt,
+		Name:        updatedPersonData.Name,
+		Surname:     updatedPersonData.Surname,
+		Patronymic:  updatedPersonData.Patronymic,
+		Age:         updatedPersonData.Age,
+		Gender:      updatedPersonData.Gender,
+		Nationality: updatedPersonData.Nationality,
+		CountryID:   updatedPersonData.CountryID,
+	}
+
+	updatedPerson, err := h.service(c).UpdatePerson(updatedPerson)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updatedPerson)
+}
+
+func (h *Handler) deletePerson(c *gin.Context) {
+	// Parse the person ID from the request URL
+	personIDInt, ok := parsePersonID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service(c).DeletePerson(personIDInt); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Person deleted successfully"})
+}
+
+func (h *Handler) restorePerson(c *gin.Context) {
+	personIDInt, ok := parsePersonID(c)
+	if !ok {
+		return
+	}
+
+	restoredPerson, err := h.service(c).RestorePerson(personIDInt)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, restoredPerson)
+}
+
+func (h *Handler) getPersonHistory(c *gin.Context) {
+	personIDInt, ok := parsePersonID(c)
+	if !ok {
+		return
+	}
+
+	history, err := h.personService.GetPersonHistory(personIDInt)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+func (h *Handler) getEnrichmentProgress(c *gin.Context) {
+	personIDInt, ok := parsePersonID(c)
+	if !ok {
+		return
+	}
+
+	progress, err := h.personService.GetEnrichmentProgress(personIDInt)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// The people one admin re-enrichment checks by default and at most, so that the
+// request ends well within the timeouts of clients and proxies. Larger passes are
+// made of several requests, each resuming from the lastId of the previous one.
+const (
+	defaultReEnrichLimit = 20
+	maxReEnrichLimit     = 50
+)
+
+// reEnrich runs a re-enrichment pass right away, e.g. once the provider quota is
+// reset, instead of waiting for the job. It does not wait between people as the job
+// does; the rate limit of the enricher still spaces the provider requests.
+func (h *Handler) reEnrich(c *gin.Context) {
+	if !auth.IsAdmin(c, h.adminToken) {
+		respondWithError(c, apperrors.Forbidden("Re-enrichment requires admin access"))
+		return
+	}
+
+	options := service.ReEnrichOptions{MaxAge: service.DefaultReEnrichOptions.MaxAge, Limit: defaultReEnrichLimit}
+	fields := map[string]string{}
+	if value := c.Query("maxAge"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			fields["maxAge"] = "maxAge must be a duration such as 720h"
+		}
+		options.MaxAge = maxAge
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxReEnrichLimit {
+			fields["limit"] = fmt.Sprintf("limit must be between 1 and %d", maxReEnrichLimit)
+		}
+		options.Limit = limit
+	}
+	if value := c.Query("afterId"); value != "" {
+		afterID, err := strconv.Atoi(value)
+		if err != nil {
+			fields["afterId"] = "afterId must be an integer"
+		}
+		options.AfterID = afterID
+	}
+	if len(fields) > 0 {
+		respondWithError(c, apperrors.InvalidFields(fields))
+		return
+	}
+
+	result, err := h.service(c).ReEnrichPeople(options)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// service scopes the person service to the actor of a REST request.
+func (h *Handler) service(c *gin.Context) service.PersonService {
+	return h.personService.WithOrigin(entities.ChangeOrigin{Actor: c.GetHeader(auth.ActorHeader), Source: entities.SourceREST})
+}
+
+// respondWithError answers with the problem details for err and logs the full error.
+func respondWithError(c *gin.Context, err error) {
+	p := problem.FromError(err)
+	if p.Status >= http.StatusInternalServerError {
+		fmt.Printf("Error handling %s %s: %v\n", c.Request.Method, c.Request.URL.Path, err)
+	}
+	problem.Write(c, p)
+}
+
+// parsePersonID reads the :id path parameter, answering 400 when it is not an integer.
+func parsePersonID(c *gin.Context) (int, bool) {
+	personID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, apperrors.InvalidFields(map[string]string{"id": "Person ID must be an integer"}))
+		return 0, false
+	}
+	return personID, true
+}
+
+// splitList splits a comma-separated query parameter, ignoring empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,82 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Domain error kinds returned by repositories and services. Match them with errors.Is.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+	ErrUpstream   = errors.New("upstream failure")
+	ErrForbidden  = errors.New("forbidden")
+)
+
+// Error is a domain error of a given kind with a message that is safe to show to clients.
+// The underlying cause, if any, is kept for logs and errors.Is/As but never shown.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+	// Fields holds per-field messages of a validation error, keyed by field name.
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+func NotFound(format string, args ...interface{}) error {
+	return &Error{Kind: ErrNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func Conflict(err error, format string, args ...interface{}) error {
+	return &Error{Kind: ErrConflict, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+func Validation(format string, args ...interface{}) error {
+	return &Error{Kind: ErrValidation, Message: fmt.Sprintf(format, args...)}
+}
+
+// InvalidFields reports a validation error for one or more fields.
+func InvalidFields(fields map[string]string) error {
+	return &Error{Kind: ErrValidation, Message: "Validation failed", Fields: fields}
+}
+
+// FieldErrors returns the per-field messages of a validation error, if any.
+func FieldErrors(err error) map[string]string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Fields
+	}
+	return nil
+}
+
+func Forbidden(format string, args ...interface{}) error {
+	return &Error{Kind: ErrForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+func Upstream(err error, format string, args ...interface{}) error {
+	return &Error{Kind: ErrUpstream, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Message returns the client-safe message of err.
+func Message(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return "Internal server error"
+}
@@ -0,0 +1,85 @@
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HTTPStatus maps an error to the HTTP status code REST handlers respond with.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUpstream):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GraphQLCode maps an error to the code reported in GraphQL error extensions.
+func GraphQLCode(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "NOT_FOUND"
+	case errors.Is(err, ErrConflict):
+		return "CONFLICT"
+	case errors.Is(err, ErrValidation):
+		return "BAD_USER_INPUT"
+	case errors.Is(err, ErrForbidden):
+		return "FORBIDDEN"
+	case errors.Is(err, ErrUpstream):
+		return "UPSTREAM_FAILURE"
+	default:
+		return "INTERNAL_SERVER_ERROR"
+	}
+}
+
+// DLQClass maps an error to the class attached to messages sent to the failed queue.
+// Consumers of the queue can replay upstream failures and drop the rest.
+func DLQClass(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, ErrValidation):
+		return "validation"
+	case errors.Is(err, ErrForbidden):
+		return "forbidden"
+	case errors.Is(err, ErrUpstream):
+		return "upstream"
+	default:
+		return "internal"
+	}
+}
+
+// GraphQLError wraps err so the GraphQL response carries its code in the error extensions.
+func GraphQLError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &graphQLError{err: err}
+}
+
+type graphQLError struct {
+	err error
+}
+
+func (e *graphQLError) Error() string {
+	return Message(e.err)
+}
+
+func (e *graphQLError) Unwrap() error {
+	return e.err
+}
+
+func (e *graphQLError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": GraphQLCode(e.err)}
+}
@@ -1,55 +1,39 @@
 package main
 
 import (
-	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"github.com/IBM/sarama"
-	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
-	"github.com/graphql-go/graphql"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"effective_mobile/api"
+	graphqlapi "effective_mobile/api/graphql"
+	"effective_mobile/cache"
+	"effective_mobile/enrichment"
 	"effective_mobile/entities"
+	"effective_mobile/fio"
+	"effective_mobile/repositories"
+	"effective_mobile/repositories/cached"
+	"effective_mobile/repositories/impl"
+	"effective_mobile/repositories/memory"
 	"effective_mobile/service"
 )
 
-var producerConfig = sarama.NewConfig()
 var redisClient *redis.Client
-var personType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Person",
-	Fields: graphql.Fields{
-		"id": &graphql.Field{
-			Type: graphql.Int,
-		},
-		"name": &graphql.Field{
-			Type: graphql.String,
-		},
-		"surname": &graphql.Field{
-			Type: graphql.String,
-		},
-		"patronymic": &graphql.Field{
-			Type: graphql.String,
-		},
-		"age": &graphql.Field{
-			Type: graphql.Int,
-		},
-		"gender": &graphql.Field{
-			Type: graphql.String,
-		},
-		"nationality": &graphql.Field{
-			Type: graphql.String,
-		},
-	},
-})
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
 	if err := godotenv.Load(); err != nil {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
@@ -63,115 +47,134 @@ func main() {
 	kafkaBroker := os.Getenv("KAFKA_BROKER")
 	kafkaTopic := os.Getenv("KAFKA_TOPIC")
 	port := os.Getenv("PORT")
-
-	db, err := sql.Open("postgres", "postgres://"+dbUser+":"+dbPassword+"@"+dbHost+":"+dbPort+"/"+dbName+"?sslmode=disable")
-	if err != nil {
-		log.Fatal(err)
+	deletedRetention := durationEnv("DELETED_RETENTION", 30*24*time.Hour)
+	purgeInterval := durationEnv("PURGE_INTERVAL", time.Hour)
+	reEnrichInterval := durationEnv("REENRICH_INTERVAL", 24*time.Hour)
+	reEnrichOptions := service.ReEnrichOptions{
+		MaxAge: durationEnv("REENRICH_MAX_AGE", service.DefaultReEnrichOptions.MaxAge),
+		Limit:  intEnv("REENRICH_BATCH", service.DefaultReEnrichOptions.Limit),
+		Delay:  durationEnv("REENRICH_DELAY", service.DefaultReEnrichOptions.Delay),
+	}
+	// One size for the enrichment entries and the people kept in process memory, where 0 disables both
+	localCacheSize := intEnv("LOCAL_CACHE_SIZE", enrichment.DefaultCacheConfig.LocalSize)
+	enrichmentLocalSize := localCacheSize
+	if enrichmentLocalSize < 1 {
+		enrichmentLocalSize = -1
+	}
+	enrichmentWorkers := intEnv("ENRICHMENT_WORKERS", 4)
+	enrichmentPollInterval := positiveDurationEnv("ENRICHMENT_POLL_INTERVAL", 5*time.Second)
+	enrichmentJobOptions := service.DefaultEnrichmentJobOptions
+	enrichmentJobOptions.MaxAttempts = intEnv("ENRICHMENT_MAX_ATTEMPTS", enrichmentJobOptions.MaxAttempts)
+	enrichmentJobOptions.RetryDelay = durationEnv("ENRICHMENT_RETRY_DELAY", enrichmentJobOptions.RetryDelay)
+	enrichmentJobOptions.MaxRetryDelay = durationEnv("ENRICHMENT_MAX_RETRY_DELAY", enrichmentJobOptions.MaxRetryDelay)
+
+	invalidator := cache.NewInvalidator(redisClient, cache.DefaultInvalidationChannel)
+	stopInvalidator := invalidator.Start()
+	defer stopInvalidator()
+
+	countryID := enrichment.NormalizeCountryID(os.Getenv("ENRICHMENT_COUNTRY_ID"))
+	if !enrichment.ValidCountryID(countryID) {
+		log.Fatalf("Invalid ENRICHMENT_COUNTRY_ID %q, expected a two-letter ISO 3166-1 code", countryID)
 	}
-	defer db.Close()
-
-	personService := service.NewPersonService(db)
-
-	var queryType = graphql.NewObject(graphql.ObjectConfig{
-		Name: "Query",
-		Fields: graphql.Fields{
-			"person": &graphql.Field{
-				Type: personType,
-				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{
-						Type: graphql.Int,
-					},
-				},
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					id, _ := p.Args["id"].(int)
-					person, err := personService.GetPersonByID(id)
-					return person, err
-				},
-			},
-		},
-	})
 
-	var mutationType = graphql.NewObject(graphql.ObjectConfig{
-		Name: "Mutation",
-		Fields: graphql.Fields{
-			"createPerson": &graphql.Field{
-				Type: personType,
-				Args: graphql.FieldConfigArgument{
-					"name": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"surname": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"patronymic": &graphql.ArgumentConfig{
-						Type: graphql.String,
-					},
-				},
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					name, _ := p.Args["name"].(string)
-					surname, _ := p.Args["surname"].(string)
-					patronymic, _ := p.Args["patronymic"].(string)
-					newPerson := &entities.Person{
-						Name:       name,
-						Surname:    surname,
-						Patronymic: patronymic,
-					}
-					createdPerson, err := personService.CreatePerson(newPerson)
-					return createdPerson, err
-				},
-			},
-			"updatePerson": &graphql.Field{
-				Type: personType,
-				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.Int),
-					},
-					"name": &graphql.ArgumentConfig{
-						Type: graphql.String,
-					},
-					"surname": &graphql.ArgumentConfig{
-						Type: graphql.String,
-					},
-					"patronymic": &graphql.ArgumentConfig{
-						Type: graphql.String,
-					},
-				},
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					id, _ := p.Args["id"].(int)
-					name, _ := p.Args["name"].(string)
-					surname, _ := p.Args["surname"].(string)
-					patronymic, _ := p.Args["patronymic"].(string)
-					updatedPerson := &entities.Person{
-						ID:         id,
-						Name:       name,
-						Surname:    surname,
-						Patronymic: patronymic,
-					}
-					updatedPerson, err := personService.UpdatePerson(updatedPerson)
-					return updatedPerson, err
-				},
-			},
-			"deletePerson": &graphql.Field{
-				Type: graphql.Boolean,
-				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.Int),
-					},
-				},
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					id, _ := p.Args["id"].(int)
-					success := personService.DeletePerson(id)
-					return success, nil
-				},
-			},
+	enricher := enrichment.NewAPIEnricher(redisClient, enrichment.Config{
+		URLs: enrichment.ProviderURLs{
+			Agify:       os.Getenv("AGIFY_URL"),
+			Genderize:   os.Getenv("GENDERIZE_URL"),
+			Nationalize: os.Getenv("NATIONALIZE_URL"),
+		},
+		APIKeys: enrichment.ProviderKeys{
+			Agify:       stringEnv("AGIFY_API_KEY", os.Getenv("ENRICHMENT_API_KEY")),
+			Genderize:   stringEnv("GENDERIZE_API_KEY", os.Getenv("ENRICHMENT_API_KEY")),
+			Nationalize: stringEnv("NATIONALIZE_API_KEY", os.Getenv("ENRICHMENT_API_KEY")),
+		},
+		RateLimit: enrichment.RateLimit{
+			RequestsPerSecond: floatEnv("ENRICHMENT_RATE_LIMIT", enrichment.DefaultRateLimit.RequestsPerSecond),
+			Burst:             intEnv("ENRICHMENT_RATE_BURST", enrichment.DefaultRateLimit.Burst),
+			MaxWait:           durationEnv("ENRICHMENT_RATE_MAX_WAIT", enrichment.DefaultRateLimit.MaxWait),
 		},
+		Cache: enrichment.CacheConfig{
+			KeyPrefix:      os.Getenv("ENRICHMENT_CACHE_PREFIX"),
+			AgeTTL:         durationEnv("ENRICHMENT_AGE_TTL", enrichment.DefaultCacheConfig.AgeTTL),
+			GenderTTL:      durationEnv("ENRICHMENT_GENDER_TTL", enrichment.DefaultCacheConfig.GenderTTL),
+			NationalityTTL: durationEnv("ENRICHMENT_NATIONALITY_TTL", enrichment.DefaultCacheConfig.NationalityTTL),
+			NotFoundTTL:    durationEnv("ENRICHMENT_NOT_FOUND_TTL", enrichment.DefaultCacheConfig.NotFoundTTL),
+			LocalSize:      enrichmentLocalSize,
+			LocalTTL:       durationEnv("LOCAL_CACHE_TTL", enrichment.DefaultCacheConfig.LocalTTL),
+			RedisTimeout:   durationEnv("REDIS_TIMEOUT", enrichment.DefaultCacheConfig.RedisTimeout),
+			Invalidator:    invalidator,
+		},
+		CountryID: countryID,
 	})
 
-	var schema, _ = graphql.NewSchema(graphql.SchemaConfig{
-		Query:    queryType,
-		Mutation: mutationType, // Add mutation type
+	var personEnricher enrichment.Enricher = enricher
+	switch mode := os.Getenv("ENRICHMENT_OFFLINE"); mode {
+	case "", "fallback", "primary":
+		offlineEnricher, err := enrichment.LoadOfflineEnricher(os.Getenv("OFFLINE_DATASET"))
+		if err != nil {
+			log.Fatalf("Failed to load the offline dataset: %v", err)
+		}
+		if mode == "primary" {
+			personEnricher = enrichment.NewFallbackEnricher(offlineEnricher, enricher)
+		} else {
+			personEnricher = enrichment.NewFallbackEnricher(enricher, offlineEnricher)
+		}
+	case "off":
+	default:
+		log.Fatalf("Invalid ENRICHMENT_OFFLINE %q, expected fallback, primary or off", mode)
+	}
+
+	var personRepository repositories.PersonRepository
+	var historyRepository repositories.PersonHistoryRepository
+	var enrichmentJobRepository repositories.EnrichmentJobRepository
+	if os.Getenv("STORAGE") == "memory" {
+		// People live only as long as the process, for local demos without Postgres
+		personRepository = memory.NewPersonRepository()
+		historyRepository = memory.NewPersonHistoryRepository()
+		enrichmentJobRepository = memory.NewEnrichmentJobRepository()
+	} else {
+		db, err := sql.Open("postgres", "postgres://"+dbUser+":"+dbPassword+"@"+dbHost+":"+dbPort+"/"+dbName+"?sslmode=disable")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		personRepository = impl.NewPersonRepository(db)
+		historyRepository = impl.NewPersonHistoryRepository(db)
+		enrichmentJobRepository = impl.NewEnrichmentJobRepository(db)
+		if personCacheTTL := durationEnv("PERSON_CACHE_TTL", cached.DefaultRedisConfig.TTL); personCacheTTL > 0 {
+			personRepository = cached.NewRedisPersonRepository(personRepository, redisClient, cached.RedisConfig{
+				TTL:     personCacheTTL,
+				Timeout: durationEnv("REDIS_TIMEOUT", cached.DefaultRedisConfig.Timeout),
+			})
+		}
+	}
+	personRepository = cached.NewLocalPersonRepository(personRepository, cached.LocalConfig{
+		Size: localCacheSize,
+		TTL:  durationEnv("LOCAL_CACHE_TTL", time.Minute),
+	}, invalidator)
+	personService := service.NewPersonServiceWithRepositories(personRepository, historyRepository, personEnricher)
+	// Re-enrichment only asks the providers; the offline statistics would not tell anything new
+	personService.ReEnricher = enricher
+	personService.EnrichmentJobs = enrichmentJobRepository
+	personService.Webhooks = service.NewWebhookSender(service.WebhookConfig{
+		AllowedHosts: listEnv("WEBHOOK_ALLOWED_HOSTS"),
+		AllowPrivate: os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true",
 	})
 
+	if purgeInterval > 0 {
+		stopPurgeJob := service.StartPurgeJob(personService.WithOrigin(entities.ChangeOrigin{Actor: "retention-job"}), purgeInterval, deletedRetention)
+		defer stopPurgeJob()
+	}
+	if reEnrichInterval > 0 {
+		stopReEnrichmentJob := service.StartReEnrichmentJob(personService.WithOrigin(entities.ChangeOrigin{Actor: "re-enrichment-job"}), reEnrichInterval, reEnrichOptions)
+		defer stopReEnrichmentJob()
+	}
+	if enrichmentWorkers > 0 {
+		stopEnrichmentWorkers := service.StartEnrichmentWorkers(personService.WithOrigin(entities.ChangeOrigin{Actor: "enrichment-worker"}), enrichmentWorkers, enrichmentPollInterval, enrichmentJobOptions)
+		defer stopEnrichmentWorkers()
+	}
+
 	broker := kafkaBroker
 	topic := kafkaTopic
 
@@ -198,162 +201,42 @@ func main() {
 		}
 	}()
 
-	go func() {
-		for message := range partitionConsumer.Messages() {
-			// Process Kafka message
-			var inputPerson entities.Person
-			if err := json.Unmarshal(message.Value, &inputPerson); err != nil {
-				fmt.Printf("Error processing message: %v\n", err)
-				sendToFailedQueue(message.Value)
-				continue
-			}
-
-			enrichedPerson, err := enrichPerson(&inputPerson)
-			if err != nil {
-				fmt.Printf("Error enriching person data: %v\n", err)
-				continue
-			}
-
-			createdPerson, err := personService.CreatePerson(enrichedPerson)
-			if err != nil {
-				fmt.Printf("Error creating person: %v\n", err)
-			} else {
-				fmt.Printf("Created Person: %+v\n", createdPerson)
-			}
+	producer, err := sarama.NewSyncProducer([]string{broker}, fio.ProducerConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := producer.Close(); err != nil {
+			fmt.Printf("Error closing Kafka producer: %v\n", err)
 		}
 	}()
 
-	router := gin.Default()
-
-	router.POST("/api/people", func(c *gin.Context) {
-		var inputPerson entities.Person
-		if err := c.BindJSON(&inputPerson); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
-			return
-		}
-
-		enrichedPerson, err := enrichPerson(&inputPerson)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error enriching person data"})
-			return
-		}
-
-		createdPerson, err := personService.CreatePerson(enrichedPerson)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating person"})
-			return
-		}
-
-		c.JSON(http.StatusCreated, createdPerson)
-	})
-
-	router.GET("/api/people/:id", func(c *gin.Context) {
-		personID := c.Param("id")
-
-		personIDInt, err := strconv.Atoi(personID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid person ID"})
-			return
-		}
-
-		person, err := personService.GetPersonByID(personIDInt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching person"})
-			return
-		}
-
-		if person == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
-			return
-		}
-
-		c.JSON(http.StatusOK, person)
-	})
-
-	router.PUT("/api/people/:id", func(c *gin.Context) {
-		// Parse the person ID from the request URL
-		personID := c.Param("id")
-
-		personIDInt, err := strconv.Atoi(personID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid person ID"})
-			return
-		}
-
-		var updatedPersonData entities.Person
-		if err := c.BindJSON(&updatedPersonData); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
-			return
-		}
-
-		existingPerson, err := personService.GetPersonByID(personIDInt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching person"})
-			return
-		}
-
-		if existingPerson == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
-			return
-		}
-
-		updatedPerson := &entities.Person{
-			ID:          existingPerson.ID,
-			Name:        updatedPersonData.Name,
-			Surname:     updatedPersonData.Surname,
-			Patronymic:  updatedPersonData.Patronymic,
-			Age:         updatedPersonData.Age,
-			Gender:      updatedPersonData.Gender,
-			Nationality: updatedPersonData.Nationality,
-		}
-
-		updatedPerson, updateErr := personService.UpdatePerson(updatedPerson)
-		if updateErr != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating person"})
-			return
-		}
+	fioConsumer := fio.NewConsumer(personService, producer)
+	fioConsumer.MaxQuotaWait = durationEnv("ENRICHMENT_QUOTA_MAX_WAIT", fio.DefaultMaxQuotaWait)
+	go fioConsumer.Run(partitionConsumer.Messages())
 
-		c.JSON(http.StatusOK, updatedPerson)
-	})
-
-	router.DELETE("/api/people/:id", func(c *gin.Context) {
-		// Parse the person ID from the request URL
-		personID := c.Param("id")
-
-		personIDInt, err := strconv.Atoi(personID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid person ID"})
-			return
-		}
-
-		success := personService.DeletePerson(personIDInt)
-		if !success {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{"message": "Person deleted successfully"})
-	})
-
-	router.POST("/graphql", func(c *gin.Context) {
-		var requestBody map[string]interface{}
-		if err := c.BindJSON(&requestBody); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
-			return
-		}
-
-		result := graphql.Do(graphql.Params{
-			Schema:        schema,
-			RequestString: requestBody["query"].(string),
-		})
-
-		if len(result.Errors) > 0 {
-			c.JSON(http.StatusInternalServerError, gin.H{"errors": result.Errors})
-			return
-		}
+	persisted, err := graphqlapi.LoadPersistedQueries(os.Getenv("GRAPHQL_PERSISTED_QUERIES"), os.Getenv("GRAPHQL_PERSISTED_ONLY") == "true")
+	if err != nil {
+		log.Fatalf("Failed to load persisted queries: %v", err)
+	}
 
-		c.JSON(http.StatusOK, result.Data)
+	router, err := api.NewRouter(personService, api.Config{
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+		Enricher:   enricher,
+		GraphQL: graphqlapi.Config{
+			Limits: graphqlapi.Limits{
+				MaxDepth: intEnv("GRAPHQL_MAX_DEPTH", 10),
+				MaxCost:  intEnv("GRAPHQL_MAX_COST", 1000),
+				Timeout:  durationEnv("GRAPHQL_TIMEOUT", 10*time.Second),
+			},
+			PersistedQueries: persisted,
+			GraphiQL:         os.Getenv("APP_ENV") == "development",
+			AllowedOrigins:   listEnv("GRAPHQL_ALLOWED_ORIGINS"),
+		},
 	})
+	if err != nil {
+		log.Fatalf("Failed to build router: %v", err)
+	}
 
 	err = router.Run(fmt.Sprintf(":%s", port))
 	if err != nil {
@@ -372,167 +255,68 @@ func init() {
 	})
 }
 
-func sendToFailedQueue(message []byte) {
-	producer, err := sarama.NewSyncProducer([]string{"localhost:9092"}, producerConfig)
-	if err != nil {
-		fmt.Printf("Error creating Kafka producer: %v\n", err)
-		return
-	}
-	defer func() {
-		if err := producer.Close(); err != nil {
-			fmt.Printf("Error closing Kafka producer: %v\n", err)
-		}
-	}()
-
-	kafkaMessage := &sarama.ProducerMessage{
-		Topic: "FIO_FAILED",
-		Value: sarama.StringEncoder(message),
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
 	}
 
-	partition, offset, err := producer.SendMessage(kafkaMessage)
+	duration, err := time.ParseDuration(value)
 	if err != nil {
-		fmt.Printf("Error sending message to FIO_FAILED Kafka queue: %v\n", err)
-		return
+		log.Fatalf("Invalid %s %q: %v", name, value, err)
 	}
-
-	fmt.Printf("Sent message to FIO_FAILED Kafka queue - Partition: %d, Offset: %d\n", partition, offset)
+	return duration
 }
 
-func enrichPerson(inputPerson *entities.Person) (*entities.Person, error) {
-	age, err := fetchAge(inputPerson.Name)
-	if err != nil {
-		return nil, err
-	}
-	inputPerson.Age = age
-
-	gender, err := fetchGender(inputPerson.Name)
-	if err != nil {
-		return nil, err
-	}
-	inputPerson.Gender = gender
-
-	nationality, err := fetchNationality(inputPerson.Name)
-	if err != nil {
-		return nil, err
+// positiveDurationEnv is durationEnv for intervals, which cannot be 0 or negative.
+func positiveDurationEnv(name string, fallback time.Duration) time.Duration {
+	duration := durationEnv(name, fallback)
+	if duration <= 0 {
+		log.Fatalf("Invalid %s %q: must be positive", name, os.Getenv(name))
 	}
-	inputPerson.Nationality = nationality
-
-	return inputPerson, nil
+	return duration
 }
 
-func fetchAge(name string) (int, error) {
-	age, err := redisClient.Get(context.Background(), "age:"+name).Int()
-	if err == nil {
-		return age, nil
+func stringEnv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
 	}
-
-	url := fmt.Sprintf("https://api.agify.io/?name=%s", name)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("Failed to fetch age data: %s", resp.Status)
-	}
-
-	var ageData map[string]int
-	json.NewDecoder(resp.Body).Decode(&ageData)
-
-	age = ageData["age"]
-	if age == 0 {
-		return 0, fmt.Errorf("Age data not found")
-	}
-
-	err = redisClient.Set(context.Background(), "age:"+name, age, 0).Err()
-	if err != nil {
-		fmt.Printf("Failed to cache age data in Redis: %v\n", err)
-	}
-
-	return age, nil
+	return fallback
 }
-func fetchGender(name string) (string, error) {
-	gender, err := redisClient.Get(context.Background(), "gender:"+name).Result()
-	if err == nil {
-		return gender, nil
-	}
-
-	url := fmt.Sprintf("https://api.genderize.io/?name=%s", name)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Failed to fetch gender data: %s", resp.Status)
-	}
-
-	var genderData map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&genderData)
-	if err != nil {
-		return "", err
-	}
-
-	gender, ok := genderData["gender"].(string)
-	if !ok {
-		return "", fmt.Errorf("Gender data not found")
-	}
-
-	err = redisClient.Set(context.Background(), "gender:"+name, gender, 0).Err()
-	if err != nil {
-		fmt.Printf("Failed to cache gender data in Redis: %v\n", err)
+// listEnv splits a comma-separated variable, ignoring empty items.
+func listEnv(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-
-	return gender, nil
+	return items
 }
 
-func fetchNationality(name string) (string, error) {
-	nationality, err := redisClient.Get(context.Background(), "nationality:"+name).Result()
-	if err == nil {
-		return nationality, nil
+func floatEnv(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
 	}
 
-	url := fmt.Sprintf("https://api.nationalize.io/?name=%s", name)
-
-	resp, err := http.Get(url)
+	number, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Failed to fetch nationality data: %s", resp.Status)
-	}
-
-	var nationalityData map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&nationalityData)
-	if err != nil {
-		return "", err
-	}
-
-	countryList, ok := nationalityData["country"].([]interface{})
-	if !ok || len(countryList) == 0 {
-		return "", fmt.Errorf("Nationality data not found")
-	}
-
-	firstCountry, ok := countryList[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("Nationality data not found")
+		log.Fatalf("Invalid %s %q: %v", name, value, err)
 	}
+	return number
+}
 
-	countryCode, ok := firstCountry["country_id"].(string)
-	if !ok {
-		return "", fmt.Errorf("Nationality data not found")
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
 	}
 
-	err = redisClient.Set(context.Background(), "nationality:"+name, countryCode, 0).Err()
+	number, err := strconv.Atoi(value)
 	if err != nil {
-		fmt.Printf("Failed to cache nationality data in Redis: %v\n", err)
+		log.Fatalf("Invalid %s %q: %v", name, value, err)
 	}
-
-	return countryCode, nil
+	return number
 }
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Breaker stops calling Redis for a cooldown after it fails, so an unavailable or slow
+// Redis costs one timeout per cooldown instead of one per request.
+type Breaker struct {
+	cooldown time.Duration
+
+	mu        sync.Mutex
+	openUntil time.Time
+}
+
+func NewBreaker(cooldown time.Duration) *Breaker {
+	return &Breaker{cooldown: cooldown}
+}
+
+// Allow reports whether Redis should be called.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !time.Now().Before(b.openUntil)
+}
+
+// Report records the outcome of a Redis call; a missing key is not a failure.
+func (b *Breaker) Report(err error) {
+	if err == nil || err == redis.Nil || err == redis.TxFailedErr {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.openUntil = time.Now().Add(b.cooldown)
+}
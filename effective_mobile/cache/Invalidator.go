@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultInvalidationChannel is the Redis channel invalidations are published on.
+const DefaultInvalidationChannel = "effective_mobile:invalidations"
+
+// Invalidator tells the other replicas to drop their in-process copy of a changed
+// entry, over Redis pub/sub. Invalidations published while a replica is disconnected
+// are lost, so in-process caches must also expire their entries.
+//
+// A nil Invalidator does nothing, for single-process setups.
+type Invalidator struct {
+	redisClient *redis.Client
+	channel     string
+	source      string
+
+	mu       sync.RWMutex
+	handlers map[string][]func(key string)
+}
+
+type invalidation struct {
+	Source    string `json:"source"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+}
+
+func NewInvalidator(redisClient *redis.Client, channel string) *Invalidator {
+	source := make([]byte, 8)
+	rand.Read(source)
+
+	return &Invalidator{
+		redisClient: redisClient,
+		channel:     channel,
+		source:      hex.EncodeToString(source),
+		handlers:    make(map[string][]func(key string)),
+	}
+}
+
+// Subscribe calls handler with the keys of the namespace invalidated by other replicas.
+func (i *Invalidator) Subscribe(namespace string, handler func(key string)) {
+	if i == nil {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.handlers[namespace] = append(i.handlers[namespace], handler)
+}
+
+// Publish tells the other replicas that a key of the namespace changed. Failures are
+// logged: the other replicas then serve the entry until it expires.
+func (i *Invalidator) Publish(ctx context.Context, namespace, key string) {
+	if i == nil {
+		return
+	}
+
+	message, err := json.Marshal(invalidation{Source: i.source, Namespace: namespace, Key: key})
+	if err != nil {
+		fmt.Printf("Failed to encode invalidation: %v\n", err)
+		return
+	}
+	if err := i.redisClient.Publish(ctx, i.channel, message).Err(); err != nil {
+		fmt.Printf("Failed to publish invalidation of %s %s: %v\n", namespace, key, err)
+	}
+}
+
+// Start listens for invalidations until the returned function is called. The
+// subscription reconnects by itself when Redis goes away.
+func (i *Invalidator) Start() func() {
+	if i == nil {
+		return func() {}
+	}
+
+	pubsub := i.redisClient.Subscribe(context.Background(), i.channel)
+	go func() {
+		for message := range pubsub.Channel() {
+			i.handle(message.Payload)
+		}
+	}()
+
+	return func() {
+		if err := pubsub.Close(); err != nil {
+			fmt.Printf("Error closing invalidation subscription: %v\n", err)
+		}
+	}
+}
+
+func (i *Invalidator) handle(payload string) {
+	var message invalidation
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		fmt.Printf("Ignoring malformed invalidation %q: %v\n", payload, err)
+		return
+	}
+	// The publisher already dropped its own copy
+	if message.Source == i.source {
+		return
+	}
+
+	i.mu.RLock()
+	handlers := i.handlers[message.Namespace]
+	i.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(message.Key)
+	}
+}
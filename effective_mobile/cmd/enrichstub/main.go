@@ -0,0 +1,49 @@
+// Command enrichstub serves the agify, genderize and nationalize APIs locally from
+// recorded fixtures, optionally injecting latency, failures and rate limiting.
+// Point the application at it with AGIFY_URL=http://localhost:8089/agify, and
+// likewise GENDERIZE_URL and NATIONALIZE_URL.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+
+	"effective_mobile/enrichstub"
+)
+
+func main() {
+	addr := flag.String("addr", ":8089", "address to listen on")
+	fixturesPath := flag.String("fixtures", "enrichstub/fixtures.json", "fixtures file to replay and record into")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	errorRate := flag.Float64("error-rate", 0, "share of requests answered with 500")
+	rateLimitRate := flag.Float64("rate-limit-rate", 0, "share of requests answered with 429")
+	quota := flag.Int("quota", 0, "requests allowed per quota window before answering 429, 0 for unlimited")
+	quotaWindow := flag.Duration("quota-window", 0, "quota window, a day by default")
+	record := flag.Bool("record", false, "fetch responses missing from the fixtures from the real APIs and save them")
+	flag.Parse()
+
+	fixtures, err := enrichstub.LoadFixtures(*fixturesPath)
+	if err != nil {
+		if !*record || !errors.Is(err, fs.ErrNotExist) {
+			log.Fatalf("Failed to load fixtures: %v", err)
+		}
+		fixtures = enrichstub.Fixtures{}
+	}
+
+	server := enrichstub.NewServer(fixtures, enrichstub.Config{
+		Latency:       *latency,
+		ErrorRate:     *errorRate,
+		RateLimitRate: *rateLimitRate,
+		Quota:         *quota,
+		QuotaWindow:   *quotaWindow,
+		Record:        *record,
+		FixturesPath:  *fixturesPath,
+	})
+
+	fmt.Printf("Serving provider stubs on %s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	graphqlapi "effective_mobile/api/graphql"
+	"effective_mobile/events"
+	"effective_mobile/sdl"
+	"effective_mobile/service"
+)
+
+// runCommand runs a subcommand instead of the server, e.g. "schema print".
+func runCommand(args []string) {
+	switch strings.Join(args, " ") {
+	case "schema print":
+		fmt.Print(schemaSDL())
+	default:
+		log.Fatalf("Unknown command %q, usage: effective_mobile [schema print]", strings.Join(args, " "))
+	}
+}
+
+// schemaSDL prints the GraphQL schema. Building it needs no database, only the event bus
+// of the subscriptions.
+func schemaSDL() string {
+	schema, err := graphqlapi.NewSchema(&service.PersonServiceImpl{Events: events.NewBus()})
+	if err != nil {
+		log.Fatalf("Failed to build GraphQL schema: %v", err)
+	}
+	return sdl.Print(schema)
+}
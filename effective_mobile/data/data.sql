@@ -5,7 +5,46 @@ CREATE TABLE IF NOT EXISTS persons (
                                        patronymic VARCHAR(255),
                                        age INT,
                                        gender VARCHAR(10),
-                                       nationality VARCHAR(255)
+                                       nationality VARCHAR(255),
+                                       country_id VARCHAR(2) NOT NULL DEFAULT '',
+                                       enrichment_source VARCHAR(16) NOT NULL DEFAULT '',
+                                       provenance JSONB NOT NULL DEFAULT '{}',
+                                       enrichment_status VARCHAR(16) NOT NULL DEFAULT '',
+                                       deleted_at TIMESTAMPTZ
 );
 
+ALTER TABLE persons ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE persons ADD COLUMN IF NOT EXISTS enrichment_source VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE persons ADD COLUMN IF NOT EXISTS provenance JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE persons ADD COLUMN IF NOT EXISTS enrichment_status VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE persons ADD COLUMN IF NOT EXISTS country_id VARCHAR(2) NOT NULL DEFAULT '';
+
+-- People enriched offline before provenance was recorded are enriched again like the others
+UPDATE persons SET provenance = '{"age": {"source": "offline", "provider": "offline", "enrichedAt": "0001-01-01T00:00:00Z"}, "gender": {"source": "offline", "provider": "offline", "enrichedAt": "0001-01-01T00:00:00Z"}, "nationality": {"source": "offline", "provider": "offline", "enrichedAt": "0001-01-01T00:00:00Z"}}'
+WHERE enrichment_source = 'offline' AND provenance = '{}';
+
+CREATE TABLE IF NOT EXISTS person_history (
+                                       id SERIAL PRIMARY KEY,
+                                       person_id INT NOT NULL,
+                                       action VARCHAR(16) NOT NULL,
+                                       before JSONB,
+                                       after JSONB,
+                                       actor VARCHAR(255) NOT NULL,
+                                       source VARCHAR(16) NOT NULL,
+                                       changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS person_history_person_id_idx ON person_history (person_id, changed_at);
+
+CREATE TABLE IF NOT EXISTS enrichment_jobs (
+                                       person_id INT PRIMARY KEY,
+                                       skip_providers TEXT[] NOT NULL DEFAULT '{}',
+                                       webhook_url TEXT NOT NULL DEFAULT '',
+                                       attempts INT NOT NULL DEFAULT 0,
+                                       next_attempt_at TIMESTAMPTZ,
+                                       last_error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS enrichment_jobs_next_attempt_at_idx ON enrichment_jobs (next_attempt_at);
+
 select * from persons
\ No newline at end of file
@@ -0,0 +1,128 @@
+package dataloader
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"errors"
+	"sync"
+)
+
+// BatchFunc fetches the people with the given IDs in one call; missing people are left out.
+type BatchFunc func(personIDs []int) ([]*entities.Person, error)
+
+// PersonLoader coalesces person lookups into batches and caches the results. Load only
+// registers the ID; the batch is fetched when the first returned thunk is called, so
+// every lookup made before that, e.g. by sibling GraphQL resolvers, shares one query.
+// A loader lives for a single request and must not be shared across requests.
+type PersonLoader struct {
+	fetch BatchFunc
+
+	mu      sync.Mutex
+	cache   map[int]*personResult
+	pending []int
+}
+
+type personResult struct {
+	person *entities.Person
+	err    error
+	done   bool
+}
+
+func NewPersonLoader(fetch BatchFunc) *PersonLoader {
+	return &PersonLoader{fetch: fetch, cache: make(map[int]*personResult)}
+}
+
+// Load returns a thunk resolving to the person with the given ID, or a not-found error.
+func (l *PersonLoader) Load(personID int) func() (*entities.Person, error) {
+	l.mu.Lock()
+	result := l.enqueue(personID)
+	l.mu.Unlock()
+
+	return func() (*entities.Person, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if !result.done {
+			l.dispatch()
+		}
+		return result.person, result.err
+	}
+}
+
+// LoadMany returns a thunk resolving to the people with the given IDs in the same
+// order, with nil for the people that do not exist.
+func (l *PersonLoader) LoadMany(personIDs []int) func() ([]*entities.Person, error) {
+	l.mu.Lock()
+	results := make([]*personResult, len(personIDs))
+	for i, personID := range personIDs {
+		results[i] = l.enqueue(personID)
+	}
+	l.mu.Unlock()
+
+	return func() ([]*entities.Person, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		people := make([]*entities.Person, len(results))
+		for i, result := range results {
+			if !result.done {
+				l.dispatch()
+			}
+			if result.err != nil && !errors.Is(result.err, apperrors.ErrNotFound) {
+				return nil, result.err
+			}
+			people[i] = result.person
+		}
+		return people, nil
+	}
+}
+
+// Clear forgets a cached person, e.g. after it was changed.
+func (l *PersonLoader) Clear(personID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if result, ok := l.cache[personID]; ok && result.done {
+		delete(l.cache, personID)
+	}
+}
+
+// enqueue returns the cached result for the ID, scheduling a fetch when it is new.
+// The caller holds l.mu.
+func (l *PersonLoader) enqueue(personID int) *personResult {
+	if result, ok := l.cache[personID]; ok {
+		return result
+	}
+
+	result := &personResult{}
+	l.cache[personID] = result
+	l.pending = append(l.pending, personID)
+	return result
+}
+
+// dispatch fetches every pending ID in one batch. The caller holds l.mu.
+func (l *PersonLoader) dispatch() {
+	personIDs := l.pending
+	l.pending = nil
+
+	people, err := l.fetch(personIDs)
+	found := make(map[int]*entities.Person, len(people))
+	for _, person := range people {
+		found[person.ID] = person
+	}
+
+	for _, personID := range personIDs {
+		result := l.cache[personID]
+		switch {
+		case err != nil:
+			result.err = err
+			// Let a later lookup retry instead of caching the failure
+			delete(l.cache, personID)
+		case found[personID] != nil:
+			result.person = found[personID]
+		default:
+			result.err = apperrors.NotFound("Person not found")
+		}
+		result.done = true
+	}
+}
@@ -0,0 +1,437 @@
+package enrichment
+
+import (
+	"context"
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// ProviderURLs are the base URLs of the provider APIs, e.g. to point them at a stub.
+type ProviderURLs struct {
+	Agify       string
+	Genderize   string
+	Nationalize string
+}
+
+// DefaultProviderURLs are the public provider APIs.
+var DefaultProviderURLs = ProviderURLs{
+	Agify:       "https://api.agify.io",
+	Genderize:   "https://api.genderize.io",
+	Nationalize: "https://api.nationalize.io",
+}
+
+// ProviderKeys are the API keys sent to the providers; providers without one are
+// called on their free tier.
+type ProviderKeys struct {
+	Agify       string
+	Genderize   string
+	Nationalize string
+}
+
+// Config configures an APIEnricher.
+type Config struct {
+	URLs      ProviderURLs
+	APIKeys   ProviderKeys
+	RateLimit RateLimit
+	Cache     CacheConfig
+	// CountryID localizes the people without a country hint of their own; empty
+	// leaves them to the global estimates.
+	CountryID string
+}
+
+// APIEnricher enriches people from the agify, genderize and nationalize APIs,
+// caching the results in Redis. Requests to each provider are throttled, and none
+// are sent while the provider reports its quota as used up.
+type APIEnricher struct {
+	cache      *Cache
+	flights    singleflight.Group
+	httpClient *http.Client
+	baseURLs   ProviderURLs
+	apiKeys    ProviderKeys
+	rateLimit  RateLimit
+	buckets    map[string]*tokenBucket
+	quotas     *QuotaTracker
+	countryID  string
+}
+
+// NewAPIEnricher builds an enricher calling the providers at config.URLs; providers
+// without a URL use their DefaultProviderURLs.
+func NewAPIEnricher(redisClient *redis.Client, config Config) *APIEnricher {
+	baseURLs := config.URLs
+	if baseURLs.Agify == "" {
+		baseURLs.Agify = DefaultProviderURLs.Agify
+	}
+	if baseURLs.Genderize == "" {
+		baseURLs.Genderize = DefaultProviderURLs.Genderize
+	}
+	if baseURLs.Nationalize == "" {
+		baseURLs.Nationalize = DefaultProviderURLs.Nationalize
+	}
+
+	rateLimit := config.RateLimit
+	if rateLimit.RequestsPerSecond == 0 {
+		rateLimit.RequestsPerSecond = DefaultRateLimit.RequestsPerSecond
+	}
+	if rateLimit.Burst == 0 {
+		rateLimit.Burst = DefaultRateLimit.Burst
+	}
+	if rateLimit.MaxWait == 0 {
+		rateLimit.MaxWait = DefaultRateLimit.MaxWait
+	}
+	buckets := map[string]*tokenBucket{}
+	if rateLimit.RequestsPerSecond > 0 {
+		for _, provider := range Providers {
+			buckets[provider] = newTokenBucket(rateLimit.RequestsPerSecond, rateLimit.Burst)
+		}
+	}
+
+	cache := NewCache(redisClient, config.Cache)
+	return &APIEnricher{
+		cache:      cache,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		baseURLs:   baseURLs,
+		apiKeys:    config.APIKeys,
+		rateLimit:  rateLimit,
+		buckets:    buckets,
+		quotas:     NewQuotaTracker(redisClient, cache.config.RedisTimeout),
+		countryID:  NormalizeCountryID(config.CountryID),
+	}
+}
+
+// Cache returns the cache of provider results.
+func (e *APIEnricher) Cache() *Cache {
+	return e.cache
+}
+
+// Quotas returns the quotas last reported by the providers.
+func (e *APIEnricher) Quotas() *QuotaTracker {
+	return e.quotas
+}
+
+// WarmResult reports the outcome of warming the cache.
+type WarmResult struct {
+	Warmed int               `json:"warmed"`
+	Failed map[string]string `json:"failed"`
+}
+
+// Warm enriches the names with a few workers so that their results are cached.
+// Names the providers do not know are cached as such and count as warmed.
+func (e *APIEnricher) Warm(names []string, workers int) WarmResult {
+	result := WarmResult{Failed: map[string]string{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	queue := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				err := e.Enrich(&entities.Person{Name: name}, nil)
+
+				mu.Lock()
+				if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+					result.Failed[name] = apperrors.Message(err)
+				} else {
+					result.Warmed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+	return result
+}
+
+func (e *APIEnricher) Enrich(person *entities.Person, skipProviders []string) error {
+	return e.enrich(person, skipProviders, time.Time{})
+}
+
+// ReEnrich is Enrich treating the results cached before fetchedAfter as missing, so
+// that they are fetched from the providers again.
+func (e *APIEnricher) ReEnrich(person *entities.Person, skipProviders []string, fetchedAfter time.Time) error {
+	return e.enrich(person, skipProviders, fetchedAfter)
+}
+
+// enrich localizes the age and gender to the country hint of the person, or to the
+// default one. Nationalize predicts the country itself, so it is never given a hint.
+func (e *APIEnricher) enrich(person *entities.Person, skipProviders []string, fetchedAfter time.Time) error {
+	countryID := NormalizeCountryID(person.CountryID)
+	if countryID == "" {
+		countryID = e.countryID
+	}
+	entry := e.cachedEntry(person.Name, countryID, fetchedAfter)
+	globalEntry := entry
+	if countryID != "" {
+		globalEntry = e.cachedEntry(person.Name, "", fetchedAfter)
+	}
+
+	if !contains(skipProviders, ProviderAgify) {
+		value, provenance, err := e.lookup(entry, ProviderAgify, person.Name, countryID, func(name, countryID string) (string, float64, error) {
+			age, err := e.fetchAge(name, countryID)
+			return strconv.Itoa(age), 0, err
+		})
+		if err != nil {
+			return err
+		}
+		person.Age, _ = strconv.Atoi(value)
+		person.Provenance.Age = provenance
+	}
+
+	if !contains(skipProviders, ProviderGenderize) {
+		gender, provenance, err := e.lookup(entry, ProviderGenderize, person.Name, countryID, e.fetchGender)
+		if err != nil {
+			return err
+		}
+		person.Gender = gender
+		person.Provenance.Gender = provenance
+	}
+
+	if !contains(skipProviders, ProviderNationalize) {
+		nationality, provenance, err := e.lookup(globalEntry, ProviderNationalize, person.Name, "", e.fetchNationality)
+		if err != nil {
+			return err
+		}
+		person.Nationality = nationality
+		person.Provenance.Nationality = provenance
+	}
+
+	if !containsAll(skipProviders, Providers) {
+		person.EnrichmentSource = entities.EnrichmentSourceAPI
+	}
+	return nil
+}
+
+// cachedEntry returns what is cached for a name in a country, without the results
+// fetched before fetchedAfter.
+func (e *APIEnricher) cachedEntry(name, countryID string, fetchedAfter time.Time) CacheEntry {
+	entry, err := e.cache.Get(context.Background(), CacheName(name, countryID))
+	if err != nil {
+		fmt.Printf("Failed to read enrichment cache from Redis: %v\n", err)
+	}
+	for provider, attribute := range entry.Attributes {
+		if attribute.FetchedAt.Before(fetchedAfter) {
+			delete(entry.Attributes, provider)
+		}
+	}
+	return entry
+}
+
+// lookup answers from the cache entry, or fetches from the provider and caches the
+// result, including a provider not knowing the name. Concurrent lookups of the same
+// name and provider share one request and one cache write.
+func (e *APIEnricher) lookup(entry CacheEntry, provider, name, countryID string, fetch fetchFunc) (string, entities.AttributeProvenance, error) {
+	source := entities.EnrichmentSourceCache
+	attribute, ok := entry.Attributes[provider]
+	if !ok {
+		source = entities.EnrichmentSourceAPI
+		result, err, _ := e.flights.Do(provider+":"+NormalizeName(CacheName(name, countryID)), func() (interface{}, error) {
+			return e.fetchAndCache(provider, name, countryID, fetch)
+		})
+		if err != nil {
+			return "", entities.AttributeProvenance{}, err
+		}
+		attribute = result.(CachedAttribute)
+	}
+
+	if attribute.NotFound {
+		return "", entities.AttributeProvenance{}, notFoundError(provider)
+	}
+	provenance := entities.AttributeProvenance{
+		Source:     source,
+		Provider:   provider,
+		Confidence: attribute.Confidence,
+		EnrichedAt: attribute.FetchedAt,
+	}
+	return attribute.Value, provenance, nil
+}
+
+// fetchFunc fetches the value of an attribute and its confidence from a provider,
+// localized to countryID when it is not empty.
+type fetchFunc func(name, countryID string) (string, float64, error)
+
+func (e *APIEnricher) fetchAndCache(provider, name, countryID string, fetch fetchFunc) (CachedAttribute, error) {
+	value, confidence, err := fetch(name, countryID)
+	var attribute CachedAttribute
+	switch {
+	case errors.Is(err, apperrors.ErrNotFound):
+		attribute = e.cache.NotFound()
+	case err != nil:
+		return CachedAttribute{}, err
+	default:
+		attribute = e.cache.Found(provider, value, confidence)
+	}
+
+	err = e.cache.Update(context.Background(), CacheName(name, countryID), func(entry CacheEntry) {
+		entry.Attributes[provider] = attribute
+	})
+	if err != nil {
+		fmt.Printf("Failed to cache %s data in Redis: %v\n", provider, err)
+	}
+	return attribute, nil
+}
+
+func notFoundError(provider string) error {
+	switch provider {
+	case ProviderAgify:
+		return apperrors.NotFound("Age data not found")
+	case ProviderGenderize:
+		return apperrors.NotFound("Gender data not found")
+	default:
+		return apperrors.NotFound("Nationality data not found")
+	}
+}
+
+// get requests what a provider knows about a name once the rate limit allows it, and
+// records the quota the provider reports. It fails right away while the quota is
+// exhausted, and when the request would wait longer than RateLimit.MaxWait.
+func (e *APIEnricher) get(provider, name, countryID string) (*http.Response, error) {
+	ctx := context.Background()
+	if quota, ok := e.quotas.Get(ctx, provider); ok && quota.Exhausted() {
+		return nil, &QuotaExhaustedError{Provider: provider, ResetAt: quota.ResetAt}
+	}
+	if bucket := e.buckets[provider]; bucket != nil {
+		wait, ok := bucket.reserve(e.rateLimit.MaxWait)
+		if !ok {
+			return nil, fmt.Errorf("%s rate limit would delay the request by %s", provider, wait)
+		}
+		time.Sleep(wait)
+	}
+
+	var baseURL, apiKey string
+	switch provider {
+	case ProviderAgify:
+		baseURL, apiKey = e.baseURLs.Agify, e.apiKeys.Agify
+	case ProviderGenderize:
+		baseURL, apiKey = e.baseURLs.Genderize, e.apiKeys.Genderize
+	default:
+		baseURL, apiKey = e.baseURLs.Nationalize, e.apiKeys.Nationalize
+	}
+
+	resp, err := e.httpClient.Get(providerURL(baseURL, name, apiKey, countryID))
+	if err != nil {
+		return nil, err
+	}
+	if quota, ok := quotaFromResponse(resp); ok {
+		e.quotas.Record(ctx, provider, quota)
+		if resp.StatusCode == http.StatusTooManyRequests && quota.Exhausted() {
+			resp.Body.Close()
+			return nil, &QuotaExhaustedError{Provider: provider, ResetAt: quota.ResetAt}
+		}
+	}
+	return resp, nil
+}
+
+func (e *APIEnricher) fetchAge(name, countryID string) (int, error) {
+	resp, err := e.get(ProviderAgify, name, countryID)
+	if err != nil {
+		return 0, apperrors.Upstream(err, "Failed to fetch age data")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, apperrors.Upstream(fmt.Errorf("unexpected status %s", resp.Status), "Failed to fetch age data")
+	}
+
+	var ageData map[string]int
+	json.NewDecoder(resp.Body).Decode(&ageData)
+
+	age := ageData["age"]
+	if age == 0 {
+		return 0, notFoundError(ProviderAgify)
+	}
+
+	return age, nil
+}
+
+// fetchGender returns the gender and its probability.
+func (e *APIEnricher) fetchGender(name, countryID string) (string, float64, error) {
+	resp, err := e.get(ProviderGenderize, name, countryID)
+	if err != nil {
+		return "", 0, apperrors.Upstream(err, "Failed to fetch gender data")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, apperrors.Upstream(fmt.Errorf("unexpected status %s", resp.Status), "Failed to fetch gender data")
+	}
+
+	var genderData map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&genderData)
+	if err != nil {
+		return "", 0, apperrors.Upstream(err, "Failed to decode gender data")
+	}
+
+	gender, ok := genderData["gender"].(string)
+	if !ok {
+		return "", 0, notFoundError(ProviderGenderize)
+	}
+
+	probability, _ := genderData["probability"].(float64)
+	return gender, probability, nil
+}
+
+// fetchNationality returns the most likely country and its probability.
+func (e *APIEnricher) fetchNationality(name, countryID string) (string, float64, error) {
+	resp, err := e.get(ProviderNationalize, name, countryID)
+	if err != nil {
+		return "", 0, apperrors.Upstream(err, "Failed to fetch nationality data")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, apperrors.Upstream(fmt.Errorf("unexpected status %s", resp.Status), "Failed to fetch nationality data")
+	}
+
+	var nationalityData map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&nationalityData)
+	if err != nil {
+		return "", 0, apperrors.Upstream(err, "Failed to decode nationality data")
+	}
+
+	countryList, ok := nationalityData["country"].([]interface{})
+	if !ok || len(countryList) == 0 {
+		return "", 0, notFoundError(ProviderNationalize)
+	}
+
+	firstCountry, ok := countryList[0].(map[string]interface{})
+	if !ok {
+		return "", 0, notFoundError(ProviderNationalize)
+	}
+
+	countryCode, ok := firstCountry["country_id"].(string)
+	if !ok {
+		return "", 0, notFoundError(ProviderNationalize)
+	}
+
+	probability, _ := firstCountry["probability"].(float64)
+	return countryCode, probability, nil
+}
+
+func providerURL(baseURL, name, apiKey, countryID string) string {
+	query := url.Values{"name": {name}}
+	if apiKey != "" {
+		query.Set("apikey", apiKey)
+	}
+	if countryID != "" {
+		query.Set("country_id", countryID)
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/?" + query.Encode()
+}
@@ -0,0 +1,429 @@
+package enrichment
+
+import (
+	"context"
+	"effective_mobile/cache"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// CacheConfig configures how long enrichment results stay in Redis.
+type CacheConfig struct {
+	// KeyPrefix namespaces the cache keys; bump its version when the entry format changes.
+	KeyPrefix      string
+	AgeTTL         time.Duration
+	GenderTTL      time.Duration
+	NationalityTTL time.Duration
+	// NotFoundTTL is how long a name the provider knows nothing about is remembered.
+	NotFoundTTL time.Duration
+	// LocalSize is how many names are also kept in process memory; 0 takes the default
+	// and below 0 disables it.
+	LocalSize int
+	// LocalTTL bounds how long a name is served from process memory without Redis.
+	LocalTTL time.Duration
+	// RedisTimeout bounds every Redis call; a failing Redis is skipped for a while.
+	RedisTimeout time.Duration
+	// Invalidator propagates changes to the process memory of other replicas.
+	Invalidator *cache.Invalidator
+}
+
+// DefaultCacheConfig is used for the CacheConfig fields left zero.
+var DefaultCacheConfig = CacheConfig{
+	KeyPrefix:      "enrichment:v2:",
+	AgeTTL:         30 * 24 * time.Hour,
+	GenderTTL:      30 * 24 * time.Hour,
+	NationalityTTL: 30 * 24 * time.Hour,
+	NotFoundTTL:    time.Hour,
+	LocalSize:      10000,
+	LocalTTL:       time.Minute,
+	RedisTimeout:   200 * time.Millisecond,
+}
+
+// invalidationNamespace is the namespace of enrichment entries in cache invalidations.
+const invalidationNamespace = "enrichment"
+
+// redisCooldown is how long Redis is skipped after a failed call.
+const redisCooldown = 5 * time.Second
+
+// CacheEntry holds everything cached about a name, keyed by provider.
+type CacheEntry struct {
+	Attributes map[string]CachedAttribute `json:"attributes"`
+}
+
+// CachedAttribute is a provider result, or the provider not knowing the name.
+type CachedAttribute struct {
+	Value string `json:"value,omitempty"`
+	// Confidence is the probability the provider gave, 0 when it gives none.
+	Confidence float64   `json:"confidence,omitempty"`
+	NotFound   bool      `json:"notFound,omitempty"`
+	FetchedAt  time.Time `json:"fetchedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Cache stores one CacheEntry per name in Redis, keeping the recently used names in
+// process memory as well. When Redis fails, it keeps working from process memory.
+type Cache struct {
+	redisClient *redis.Client
+	config      CacheConfig
+	local       *cache.LRU[string, CacheEntry]
+	breaker     *cache.Breaker
+}
+
+// NewCache builds a cache on Redis. The settings left at zero take their value from
+// DefaultCacheConfig, so the process memory is disabled with a negative LocalSize.
+func NewCache(redisClient *redis.Client, config CacheConfig) *Cache {
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = DefaultCacheConfig.KeyPrefix
+	}
+	if config.AgeTTL == 0 {
+		config.AgeTTL = DefaultCacheConfig.AgeTTL
+	}
+	if config.GenderTTL == 0 {
+		config.GenderTTL = DefaultCacheConfig.GenderTTL
+	}
+	if config.NationalityTTL == 0 {
+		config.NationalityTTL = DefaultCacheConfig.NationalityTTL
+	}
+	if config.NotFoundTTL == 0 {
+		config.NotFoundTTL = DefaultCacheConfig.NotFoundTTL
+	}
+	if config.LocalSize == 0 {
+		config.LocalSize = DefaultCacheConfig.LocalSize
+	}
+	if config.LocalTTL == 0 {
+		config.LocalTTL = DefaultCacheConfig.LocalTTL
+	}
+	if config.RedisTimeout == 0 {
+		config.RedisTimeout = DefaultCacheConfig.RedisTimeout
+	}
+
+	c := &Cache{
+		redisClient: redisClient,
+		config:      config,
+		local:       cache.NewLRU[string, CacheEntry](config.LocalSize, config.LocalTTL),
+		breaker:     cache.NewBreaker(redisCooldown),
+	}
+	config.Invalidator.Subscribe(invalidationNamespace, c.local.Delete)
+	return c
+}
+
+// Key returns the Redis key of the entry for a name. Names differing only in case
+// or surrounding spaces share an entry.
+func (c *Cache) Key(name string) string {
+	return c.config.KeyPrefix + NormalizeName(name)
+}
+
+// Get returns the live attributes cached for a name; a missing entry is empty.
+func (c *Cache) Get(ctx context.Context, name string) (CacheEntry, error) {
+	key := NormalizeName(name)
+	if entry, ok := c.local.Get(key); ok {
+		return live(entry), nil
+	}
+	if !c.breaker.Allow() {
+		return CacheEntry{Attributes: map[string]CachedAttribute{}}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.RedisTimeout)
+	defer cancel()
+
+	entry, err := c.get(ctx, c.redisClient, c.Key(name))
+	c.breaker.Report(err)
+	if err != nil {
+		return entry, err
+	}
+	c.local.Set(key, entry)
+	return live(entry), nil
+}
+
+// Set stores the entry for a name until its last attribute expires.
+func (c *Cache) Set(ctx context.Context, name string, entry CacheEntry) error {
+	entry = live(entry)
+	c.local.Set(NormalizeName(name), entry)
+	if !c.breaker.Allow() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.RedisTimeout)
+	defer cancel()
+
+	err := c.set(ctx, c.redisClient, c.Key(name), entry)
+	c.breaker.Report(err)
+	if err == nil {
+		c.config.Invalidator.Publish(ctx, invalidationNamespace, NormalizeName(name))
+	}
+	return err
+}
+
+// Update applies change to the entry of a name atomically, so concurrent writers of
+// different attributes do not overwrite each other. While Redis is unavailable only
+// the entry in process memory is changed.
+func (c *Cache) Update(ctx context.Context, name string, change func(entry CacheEntry)) error {
+	key := NormalizeName(name)
+	if !c.breaker.Allow() {
+		c.updateLocal(key, change)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.RedisTimeout)
+	defer cancel()
+
+	var updated CacheEntry
+	update := func(tx *redis.Tx) error {
+		entry, err := c.get(ctx, tx, c.Key(name))
+		if err != nil {
+			return err
+		}
+		change(entry)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return c.set(ctx, pipe, c.Key(name), entry)
+		})
+		updated = entry
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if err = c.redisClient.Watch(ctx, update, c.Key(name)); err != redis.TxFailedErr {
+			break
+		}
+	}
+	c.breaker.Report(err)
+	if err != nil {
+		// Keep the change for this process at least
+		c.updateLocal(key, change)
+		return err
+	}
+
+	c.local.Set(key, updated)
+	c.config.Invalidator.Publish(ctx, invalidationNamespace, key)
+	return nil
+}
+
+// Inspect returns the entry of a name as stored in Redis, expired attributes included,
+// and whether there is one.
+func (c *Cache) Inspect(ctx context.Context, name string) (CacheEntry, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.RedisTimeout)
+	defer cancel()
+
+	data, err := c.redisClient.Get(ctx, c.Key(name)).Bytes()
+	if err == redis.Nil {
+		return CacheEntry{}, false, nil
+	}
+	if err != nil {
+		return CacheEntry{}, false, err
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return CacheEntry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// Evict drops everything cached about a name, including its results localized to
+// any country, here and on the other replicas. Evicting CacheName(name, countryID)
+// drops the results of that country only.
+func (c *Cache) Evict(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.RedisTimeout)
+	defer cancel()
+
+	countries, err := c.scanCountries(ctx, name)
+	if err != nil {
+		return err
+	}
+	keys := []string{NormalizeName(name)}
+	for _, countryID := range countries {
+		keys = append(keys, NormalizeName(CacheName(name, countryID)))
+	}
+
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		c.local.Delete(key)
+		redisKeys[i] = c.config.KeyPrefix + key
+	}
+	if err := c.redisClient.Del(ctx, redisKeys...).Err(); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		c.config.Invalidator.Publish(ctx, invalidationNamespace, key)
+	}
+	return nil
+}
+
+// Countries returns the countries results of a name are cached for, apart from its
+// global results.
+func (c *Cache) Countries(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.RedisTimeout)
+	defer cancel()
+
+	return c.scanCountries(ctx, name)
+}
+
+func (c *Cache) scanCountries(ctx context.Context, name string) ([]string, error) {
+	prefix := c.config.KeyPrefix + NormalizeName(name) + "@"
+	var countries []string
+	iter := c.redisClient.Scan(ctx, 0, escapeGlob(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		countries = append(countries, NormalizeCountryID(strings.TrimPrefix(iter.Val(), prefix)))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(countries)
+	return countries, nil
+}
+
+// EvictMatching drops the results of a provider, or everything when provider is
+// empty, for the names matching a Redis glob pattern such as "iv*". It returns how
+// many names were changed.
+func (c *Cache) EvictMatching(ctx context.Context, pattern, provider string) (int, error) {
+	// The results localized to a country are keyed by the name followed by @country
+	var names []string
+	seen := map[string]bool{}
+	for _, keyPattern := range []string{NormalizeName(pattern), NormalizeName(pattern) + "@*"} {
+		iter := c.redisClient.Scan(ctx, 0, c.config.KeyPrefix+keyPattern, 100).Iterator()
+		for iter.Next(ctx) {
+			if name := strings.TrimPrefix(iter.Val(), c.config.KeyPrefix); !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, name := range names {
+		var err error
+		if provider == "" {
+			err = c.evictKey(ctx, name)
+		} else {
+			err = c.Update(ctx, name, func(entry CacheEntry) {
+				delete(entry.Attributes, provider)
+			})
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(names), nil
+}
+
+// evictKey drops the entry of one cache name, here and on the other replicas.
+func (c *Cache) evictKey(ctx context.Context, name string) error {
+	key := NormalizeName(name)
+	c.local.Delete(key)
+	if err := c.redisClient.Del(ctx, c.config.KeyPrefix+key).Err(); err != nil {
+		return err
+	}
+	c.config.Invalidator.Publish(ctx, invalidationNamespace, key)
+	return nil
+}
+
+func (c *Cache) updateLocal(key string, change func(entry CacheEntry)) {
+	entry, _ := c.local.Get(key)
+	entry = live(entry)
+	change(entry)
+	c.local.Set(key, entry)
+}
+
+func (c *Cache) get(ctx context.Context, client redis.Cmdable, key string) (CacheEntry, error) {
+	entry := CacheEntry{Attributes: map[string]CachedAttribute{}}
+
+	data, err := client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return entry, nil
+	}
+	if err != nil {
+		return entry, err
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return CacheEntry{Attributes: map[string]CachedAttribute{}}, err
+	}
+
+	return live(entry), nil
+}
+
+func (c *Cache) set(ctx context.Context, client redis.Cmdable, key string, entry CacheEntry) error {
+	var expiresAt time.Time
+	for _, attribute := range entry.Attributes {
+		if attribute.ExpiresAt.After(expiresAt) {
+			expiresAt = attribute.ExpiresAt
+		}
+	}
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return client.Del(ctx, key).Err()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, key, data, ttl).Err()
+}
+
+// Found builds the cached attribute for a provider result.
+func (c *Cache) Found(provider, value string, confidence float64) CachedAttribute {
+	now := time.Now()
+	return CachedAttribute{Value: value, Confidence: confidence, FetchedAt: now, ExpiresAt: now.Add(c.ttl(provider))}
+}
+
+// NotFound builds the short-lived cached attribute for a name the provider does not know.
+func (c *Cache) NotFound() CachedAttribute {
+	now := time.Now()
+	return CachedAttribute{NotFound: true, FetchedAt: now, ExpiresAt: now.Add(c.config.NotFoundTTL)}
+}
+
+func (c *Cache) ttl(provider string) time.Duration {
+	switch provider {
+	case ProviderAgify:
+		return c.config.AgeTTL
+	case ProviderGenderize:
+		return c.config.GenderTTL
+	default:
+		return c.config.NationalityTTL
+	}
+}
+
+// live returns a copy of the entry without its expired attributes.
+func live(entry CacheEntry) CacheEntry {
+	attributes := make(map[string]CachedAttribute, len(entry.Attributes))
+	now := time.Now()
+	for provider, attribute := range entry.Attributes {
+		if attribute.ExpiresAt.After(now) {
+			attributes[provider] = attribute
+		}
+	}
+	return CacheEntry{Attributes: attributes}
+}
+
+// CacheName returns the name the results localized to a country are cached under,
+// e.g. "Ivan@UA" keyed as ivan@ua, apart from the global results of the name itself.
+func CacheName(name, countryID string) string {
+	if countryID == "" {
+		return name
+	}
+	return name + "@" + countryID
+}
+
+// escapeGlob escapes the characters Redis patterns give a meaning to.
+func escapeGlob(value string) string {
+	var escaped strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(`*?[]\\`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// NormalizeName folds a name to the form used to key cached results.
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,85 @@
+package enrichment
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"strings"
+	"time"
+)
+
+// Providers that can be skipped when enriching a person.
+const (
+	ProviderAgify       = "agify"
+	ProviderGenderize   = "genderize"
+	ProviderNationalize = "nationalize"
+)
+
+var Providers = []string{ProviderAgify, ProviderGenderize, ProviderNationalize}
+
+// AttributeProviders maps the enriched attributes to the providers filling them in.
+var AttributeProviders = map[string]string{
+	entities.AttributeAge:         ProviderAgify,
+	entities.AttributeGender:      ProviderGenderize,
+	entities.AttributeNationality: ProviderNationalize,
+}
+
+type Enricher interface {
+	// Enrich fills in the age, gender and nationality of the person and their
+	// provenance, leaving the attributes of skipped providers untouched.
+	Enrich(person *entities.Person, skipProviders []string) error
+}
+
+// ReEnricher enriches people again without reusing results fetched before fetchedAfter.
+type ReEnricher interface {
+	ReEnrich(person *entities.Person, skipProviders []string, fetchedAfter time.Time) error
+}
+
+// ValidateProviders rejects provider names that are not known.
+func ValidateProviders(providers []string) error {
+	for _, provider := range providers {
+		if !contains(Providers, provider) {
+			return apperrors.InvalidFields(map[string]string{"skipProviders": "Unknown provider " + provider})
+		}
+	}
+	return nil
+}
+
+// NormalizeCountryID folds a country hint to the upper-case form the providers expect.
+func NormalizeCountryID(countryID string) string {
+	return strings.ToUpper(strings.TrimSpace(countryID))
+}
+
+// ValidCountryID reports whether a normalized country hint is empty or looks like an
+// ISO 3166-1 alpha-2 code.
+func ValidCountryID(countryID string) bool {
+	if countryID == "" {
+		return true
+	}
+	if len(countryID) != 2 {
+		return false
+	}
+	for _, r := range countryID {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(values []string, wanted []string) bool {
+	for _, value := range wanted {
+		if !contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
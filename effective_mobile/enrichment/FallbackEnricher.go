@@ -0,0 +1,42 @@
+package enrichment
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"errors"
+	"fmt"
+)
+
+// FallbackEnricher enriches with the primary enricher, turning to the fallback when
+// the primary fails or does not know the name. Validation errors are not retried.
+type FallbackEnricher struct {
+	primary  Enricher
+	fallback Enricher
+}
+
+func NewFallbackEnricher(primary, fallback Enricher) *FallbackEnricher {
+	return &FallbackEnricher{primary: primary, fallback: fallback}
+}
+
+func (e *FallbackEnricher) Enrich(person *entities.Person, skipProviders []string) error {
+	// The primary may have filled in some attributes before failing
+	enriched := *person
+	err := e.primary.Enrich(&enriched, skipProviders)
+	if err == nil {
+		*person = enriched
+		return nil
+	}
+	if errors.Is(err, apperrors.ErrValidation) {
+		return err
+	}
+
+	if fallbackErr := e.fallback.Enrich(person, skipProviders); fallbackErr != nil {
+		// The primary failure explains more than the fallback not knowing the name
+		if errors.Is(fallbackErr, apperrors.ErrNotFound) {
+			return err
+		}
+		return fallbackErr
+	}
+	fmt.Printf("Enriched %s from the fallback after: %v\n", person.Name, err)
+	return nil
+}
@@ -0,0 +1,152 @@
+package enrichment
+
+import (
+	"effective_mobile/entities"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// offlineProvider is the provider recorded in the provenance of offline attributes.
+const offlineProvider = "offline"
+
+// defaultDataset is the bundled name statistics, approximating what the providers
+// answer for common names.
+//
+//go:embed names.csv
+var defaultDataset string
+
+// NameStatistics is what the offline dataset knows about a name.
+type NameStatistics struct {
+	Age                    int
+	Gender                 string
+	GenderProbability      float64
+	Nationality            string
+	NationalityProbability float64
+}
+
+// OfflineEnricher enriches people from a local dataset of name statistics, for when
+// the provider APIs cannot be reached or their quota is used up. People enriched by it
+// are marked with EnrichmentSourceOffline.
+type OfflineEnricher struct {
+	names map[string]NameStatistics
+}
+
+// LoadOfflineEnricher reads the dataset from a CSV file with the columns name, age,
+// gender, gender_probability, nationality and nationality_probability. An empty path
+// loads the bundled dataset.
+func LoadOfflineEnricher(path string) (*OfflineEnricher, error) {
+	if path == "" {
+		return NewOfflineEnricher(strings.NewReader(defaultDataset))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return NewOfflineEnricher(file)
+}
+
+// NewOfflineEnricher reads the dataset in the LoadOfflineEnricher format.
+func NewOfflineEnricher(dataset io.Reader) (*OfflineEnricher, error) {
+	reader := csv.NewReader(dataset)
+	reader.FieldsPerRecord = 6
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("offline dataset has no header")
+	}
+
+	names := make(map[string]NameStatistics, len(records)-1)
+	for i, record := range records[1:] {
+		statistics, err := parseNameStatistics(record)
+		if err != nil {
+			return nil, fmt.Errorf("offline dataset line %d: %w", i+2, err)
+		}
+		names[NormalizeName(record[0])] = statistics
+	}
+	return &OfflineEnricher{names: names}, nil
+}
+
+func parseNameStatistics(record []string) (NameStatistics, error) {
+	var statistics NameStatistics
+	var err error
+
+	// Empty fields are unknown
+	if record[1] != "" {
+		if statistics.Age, err = strconv.Atoi(record[1]); err != nil {
+			return statistics, fmt.Errorf("invalid age %q", record[1])
+		}
+	}
+	statistics.Gender = record[2]
+	if record[3] != "" {
+		if statistics.GenderProbability, err = strconv.ParseFloat(record[3], 64); err != nil {
+			return statistics, fmt.Errorf("invalid gender probability %q", record[3])
+		}
+	}
+	statistics.Nationality = record[4]
+	if record[5] != "" {
+		if statistics.NationalityProbability, err = strconv.ParseFloat(record[5], 64); err != nil {
+			return statistics, fmt.Errorf("invalid nationality probability %q", record[5])
+		}
+	}
+	return statistics, nil
+}
+
+// Lookup returns the statistics of a name and whether the dataset knows it.
+func (e *OfflineEnricher) Lookup(name string) (NameStatistics, bool) {
+	statistics, ok := e.names[NormalizeName(name)]
+	return statistics, ok
+}
+
+func (e *OfflineEnricher) Enrich(person *entities.Person, skipProviders []string) error {
+	statistics, _ := e.Lookup(person.Name)
+	provenance := func(confidence float64) entities.AttributeProvenance {
+		return entities.AttributeProvenance{
+			Source:     entities.EnrichmentSourceOffline,
+			Provider:   offlineProvider,
+			Confidence: confidence,
+			EnrichedAt: time.Now(),
+		}
+	}
+
+	if !contains(skipProviders, ProviderAgify) {
+		if statistics.Age == 0 {
+			return notFoundError(ProviderAgify)
+		}
+		person.Age = statistics.Age
+		person.Provenance.Age = provenance(0)
+	}
+
+	if !contains(skipProviders, ProviderGenderize) {
+		if statistics.Gender == "" {
+			return notFoundError(ProviderGenderize)
+		}
+		person.Gender = statistics.Gender
+		person.Provenance.Gender = provenance(statistics.GenderProbability)
+	}
+
+	if !contains(skipProviders, ProviderNationalize) {
+		if statistics.Nationality == "" {
+			return notFoundError(ProviderNationalize)
+		}
+		person.Nationality = statistics.Nationality
+		person.Provenance.Nationality = provenance(statistics.NationalityProbability)
+	}
+
+	if !containsAll(skipProviders, Providers) {
+		person.EnrichmentSource = entities.EnrichmentSourceOffline
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package enrichment
+
+import (
+	"context"
+	"effective_mobile/cache"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// quotaKeyPrefix namespaces the quota of each provider in Redis, apart from the
+// cached names so that evicting names never forgets a quota.
+const quotaKeyPrefix = "enrichment:quota:"
+
+// rateLimitedCooldown is how long a provider is left alone after a 429 that does not
+// say when the quota resets.
+const rateLimitedCooldown = time.Minute
+
+// minRateLimitedCooldown is how long a provider is left alone at least after a 429,
+// since X-Rate-Limit-Reset is rounded down to whole seconds.
+const minRateLimitedCooldown = time.Second
+
+// Quota is what a provider said about its quota in its last response.
+type Quota struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+// Exhausted reports whether no request is left until the quota resets.
+func (q Quota) Exhausted() bool {
+	return q.Remaining <= 0 && q.ResetAt.After(time.Now())
+}
+
+// QuotaExhaustedError is returned, wrapped in an upstream error, instead of calling
+// a provider whose quota is used up.
+type QuotaExhaustedError struct {
+	Provider string
+	ResetAt  time.Time
+}
+
+func (e *QuotaExhaustedError) Error() string {
+	return fmt.Sprintf("%s quota exhausted until %s", e.Provider, e.ResetAt.Format(time.RFC3339))
+}
+
+// QuotaTracker shares the quota the providers report between the replicas through
+// Redis. While Redis is unavailable, each replica goes by what it saw itself.
+type QuotaTracker struct {
+	redisClient *redis.Client
+	timeout     time.Duration
+	breaker     *cache.Breaker
+
+	mu    sync.Mutex
+	local map[string]Quota
+}
+
+func NewQuotaTracker(redisClient *redis.Client, timeout time.Duration) *QuotaTracker {
+	return &QuotaTracker{
+		redisClient: redisClient,
+		timeout:     timeout,
+		breaker:     cache.NewBreaker(redisCooldown),
+		local:       map[string]Quota{},
+	}
+}
+
+// Get returns the last known quota of a provider and whether there is one.
+func (t *QuotaTracker) Get(ctx context.Context, provider string) (Quota, bool) {
+	t.mu.Lock()
+	quota, ok := t.local[provider]
+	t.mu.Unlock()
+	if !t.breaker.Allow() {
+		return quota, ok
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	data, err := t.redisClient.Get(ctx, quotaKeyPrefix+provider).Bytes()
+	t.breaker.Report(err)
+	if err != nil {
+		if err == redis.Nil {
+			return Quota{}, false
+		}
+		return quota, ok
+	}
+	if err := json.Unmarshal(data, &quota); err != nil {
+		return Quota{}, false
+	}
+	return quota, true
+}
+
+// Record stores the quota of a provider until it resets.
+func (t *QuotaTracker) Record(ctx context.Context, provider string, quota Quota) {
+	t.mu.Lock()
+	t.local[provider] = quota
+	t.mu.Unlock()
+
+	ttl := time.Until(quota.ResetAt)
+	if ttl <= 0 || !t.breaker.Allow() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	data, err := json.Marshal(quota)
+	if err != nil {
+		return
+	}
+	err = t.redisClient.Set(ctx, quotaKeyPrefix+provider, data, ttl).Err()
+	t.breaker.Report(err)
+	if err != nil {
+		fmt.Printf("Failed to store the %s quota in Redis: %v\n", provider, err)
+	}
+}
+
+// quotaFromResponse reads the X-Rate-Limit-Limit, X-Rate-Limit-Remaining and
+// X-Rate-Limit-Reset headers, the last one in seconds. A 429 without them is taken
+// as an exhausted quota for Retry-After seconds or rateLimitedCooldown.
+func quotaFromResponse(resp *http.Response) (Quota, bool) {
+	now := time.Now()
+	remaining, err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Remaining"))
+	if err != nil {
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return Quota{}, false
+		}
+		cooldown := rateLimitedCooldown
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			cooldown = time.Duration(seconds) * time.Second
+		}
+		return Quota{ResetAt: now.Add(cooldown)}, true
+	}
+
+	quota := Quota{Remaining: remaining, ResetAt: now.Add(rateLimitedCooldown)}
+	quota.Limit, _ = strconv.Atoi(resp.Header.Get("X-Rate-Limit-Limit"))
+	if seconds, err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Reset")); err == nil {
+		quota.ResetAt = now.Add(time.Duration(seconds) * time.Second)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests && quota.ResetAt.Before(now.Add(minRateLimitedCooldown)) {
+		quota.ResetAt = now.Add(minRateLimitedCooldown)
+	}
+	return quota, true
+}
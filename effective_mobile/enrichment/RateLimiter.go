@@ -0,0 +1,62 @@
+package enrichment
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit configures the token bucket throttling the requests to each provider.
+type RateLimit struct {
+	// RequestsPerSecond is the sustained rate of requests; below 0 disables the throttle.
+	RequestsPerSecond float64
+	// Burst is how many requests can be sent at once after a quiet period.
+	Burst int
+	// MaxWait is how long a request waits for its turn before failing.
+	MaxWait time.Duration
+}
+
+// DefaultRateLimit is used for the RateLimit fields left zero.
+var DefaultRateLimit = RateLimit{
+	RequestsPerSecond: 10,
+	Burst:             20,
+	MaxWait:           5 * time.Second,
+}
+
+// tokenBucket hands out up to burst tokens at once, refilled at rate per second.
+// It is safe for concurrent use.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait before using it. When the
+// wait would exceed maxWait no token is taken and it returns false.
+func (b *tokenBucket) reserve(maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return wait, false
+	}
+	// Tokens go negative so that the waiting requests queue up behind each other
+	b.tokens--
+	return wait, true
+}
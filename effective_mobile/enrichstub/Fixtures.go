@@ -0,0 +1,77 @@
+package enrichstub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Fixtures are recorded provider responses: provider name to lowercased person name,
+// followed by @country for responses localized to a country, to the response body the
+// provider returned for it.
+type Fixtures map[string]map[string]json.RawMessage
+
+func LoadFixtures(path string) (Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures Fixtures
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+// Save writes the fixtures to path with one response per line, sorted, so recordings diff cleanly.
+func (f Fixtures) Save(path string) error {
+	var out bytes.Buffer
+	out.WriteString("{\n")
+	for i, provider := range sortedKeys(f) {
+		fmt.Fprintf(&out, "  %q: {\n", provider)
+		names := sortedKeys(f[provider])
+		for j, name := range names {
+			var body bytes.Buffer
+			if err := json.Compact(&body, f[provider][name]); err != nil {
+				return fmt.Errorf("fixture %s/%s: %w", provider, name, err)
+			}
+			fmt.Fprintf(&out, "    %q: %s%s\n", name, body.Bytes(), separator(j, len(names)))
+		}
+		fmt.Fprintf(&out, "  }%s\n", separator(i, len(f)))
+	}
+	out.WriteString("}\n")
+
+	return os.WriteFile(path, out.Bytes(), 0644)
+}
+
+func separator(i, n int) string {
+	if i < n-1 {
+		return ","
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f Fixtures) lookup(provider, name string) (json.RawMessage, bool) {
+	body, ok := f[provider][strings.ToLower(name)]
+	return body, ok
+}
+
+func (f Fixtures) store(provider, name string, body json.RawMessage) {
+	if f[provider] == nil {
+		f[provider] = make(map[string]json.RawMessage)
+	}
+	f[provider][strings.ToLower(name)] = body
+}
@@ -0,0 +1,245 @@
+package enrichstub
+
+import (
+	"effective_mobile/enrichment"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config injects the failure modes the enricher has to cope with.
+type Config struct {
+	// Latency delays every response.
+	Latency time.Duration
+	// ErrorRate is the share of requests, from 0 to 1, answered with 500.
+	ErrorRate float64
+	// RateLimitRate is the share of requests, from 0 to 1, answered with 429.
+	RateLimitRate float64
+	// Quota is the number of requests allowed per QuotaWindow before every request
+	// is answered with 429, as the real APIs do; 0 is unlimited.
+	Quota       int
+	QuotaWindow time.Duration
+	// Record fetches the responses missing from the fixtures from Upstreams and saves
+	// them to FixturesPath, so they are replayed from then on.
+	Record       bool
+	Upstreams    enrichment.ProviderURLs
+	FixturesPath string
+}
+
+// Server serves the agify, genderize and nationalize APIs from fixtures under
+// /agify, /genderize and /nationalize.
+type Server struct {
+	config     Config
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	fixtures    Fixtures
+	random      *rand.Rand
+	used        int
+	windowStart time.Time
+}
+
+func NewServer(fixtures Fixtures, config Config) *Server {
+	if fixtures == nil {
+		fixtures = Fixtures{}
+	}
+	if config.QuotaWindow == 0 {
+		config.QuotaWindow = 24 * time.Hour
+	}
+	if config.Upstreams == (enrichment.ProviderURLs{}) {
+		config.Upstreams = enrichment.DefaultProviderURLs
+	}
+
+	return &Server{
+		config:      config,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		fixtures:    fixtures,
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		windowStart: time.Now(),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	provider := strings.Trim(r.URL.Path, "/")
+	if !isProvider(provider) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown provider " + provider})
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "Missing 'name' parameter"})
+		return
+	}
+
+	if s.config.Latency > 0 {
+		select {
+		case <-time.After(s.config.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	limit, remaining, reset, fault := s.admit()
+	if s.config.Quota > 0 {
+		w.Header().Set("X-Rate-Limit-Limit", strconv.Itoa(limit))
+		w.Header().Set("X-Rate-Limit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-Rate-Limit-Reset", strconv.Itoa(reset))
+	}
+	switch fault {
+	case http.StatusTooManyRequests:
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "Request limit reached"})
+		return
+	case http.StatusInternalServerError:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Injected failure"})
+		return
+	}
+
+	body, status := s.respond(provider, name, r.URL.Query())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// admit counts the request against the quota and picks an injected fault, if any.
+// It returns the rate limit headers: the quota, the requests left and the seconds
+// until the quota resets.
+func (s *Server) admit() (int, int, int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.windowStart) >= s.config.QuotaWindow {
+		s.windowStart = time.Now()
+		s.used = 0
+	}
+	reset := int(time.Until(s.windowStart.Add(s.config.QuotaWindow)).Seconds())
+
+	if s.config.Quota > 0 && s.used >= s.config.Quota {
+		return s.config.Quota, 0, reset, http.StatusTooManyRequests
+	}
+	s.used++
+	remaining := s.config.Quota - s.used
+
+	switch roll := s.random.Float64(); {
+	case roll < s.config.RateLimitRate:
+		return s.config.Quota, remaining, reset, http.StatusTooManyRequests
+	case roll < s.config.RateLimitRate+s.config.ErrorRate:
+		return s.config.Quota, remaining, reset, http.StatusInternalServerError
+	}
+	return s.config.Quota, remaining, reset, 0
+}
+
+// respond returns the recorded response for the name, recording it first in record
+// mode, or an empty result like the providers give for unknown names. Responses
+// localized with country_id are recorded apart, as name@country; when replaying, a
+// name without a localized recording gets its global one.
+func (s *Server) respond(provider, name string, query url.Values) ([]byte, int) {
+	countryID := enrichment.NormalizeCountryID(query.Get("country_id"))
+	fixtureName := enrichment.CacheName(name, countryID)
+
+	s.mu.Lock()
+	body, ok := s.fixtures.lookup(provider, fixtureName)
+	if !ok && !s.config.Record {
+		body, ok = s.fixtures.lookup(provider, name)
+	}
+	s.mu.Unlock()
+	if ok {
+		return body, http.StatusOK
+	}
+
+	if !s.config.Record {
+		return emptyResponse(provider, name), http.StatusOK
+	}
+
+	body, status, err := s.fetchUpstream(provider, name, countryID, query.Get("apikey"))
+	if err != nil {
+		fmt.Printf("Error recording %s response for %s: %v\n", provider, name, err)
+		body, _ = json.Marshal(map[string]string{"error": "Recording failed"})
+		return body, http.StatusBadGateway
+	}
+	if status != http.StatusOK {
+		return body, status
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures.store(provider, fixtureName, body)
+	if s.config.FixturesPath != "" {
+		if err := s.fixtures.Save(s.config.FixturesPath); err != nil {
+			fmt.Printf("Error saving fixtures: %v\n", err)
+		}
+	}
+	return body, http.StatusOK
+}
+
+// fetchUpstream asks the real provider, passing on the country hint and the API key
+// of the request.
+func (s *Server) fetchUpstream(provider, name, countryID, apiKey string) (json.RawMessage, int, error) {
+	upstreams := map[string]string{
+		enrichment.ProviderAgify:       s.config.Upstreams.Agify,
+		enrichment.ProviderGenderize:   s.config.Upstreams.Genderize,
+		enrichment.ProviderNationalize: s.config.Upstreams.Nationalize,
+	}
+
+	query := url.Values{"name": {name}}
+	if countryID != "" {
+		query.Set("country_id", countryID)
+	}
+	if apiKey != "" {
+		query.Set("apikey", apiKey)
+	}
+	resp, err := s.httpClient.Get(strings.TrimSuffix(upstreams[provider], "/") + "/?" + query.Encode())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !json.Valid(body) {
+		return nil, 0, fmt.Errorf("invalid JSON from %s", provider)
+	}
+	return body, resp.StatusCode, nil
+}
+
+// emptyResponse is what the providers answer for a name they know nothing about.
+func emptyResponse(provider, name string) []byte {
+	response := map[string]interface{}{"count": 0, "name": name}
+	switch provider {
+	case enrichment.ProviderAgify:
+		response["age"] = nil
+	case enrichment.ProviderGenderize:
+		response["gender"] = nil
+		response["probability"] = 0
+	case enrichment.ProviderNationalize:
+		response["country"] = []interface{}{}
+	}
+
+	body, _ := json.Marshal(response)
+	return body
+}
+
+func isProvider(provider string) bool {
+	for _, known := range enrichment.Providers {
+		if provider == known {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,15 @@
+package entities
+
+import "time"
+
+// EnrichmentJob is the asynchronous enrichment of a person stored before being enriched.
+type EnrichmentJob struct {
+	PersonID      int      `db:"person_id"`
+	SkipProviders []string `db:"skip_providers"`
+	// WebhookURL is notified once the person is enriched or its enrichment is given up.
+	WebhookURL string `db:"webhook_url"`
+	Attempts   int    `db:"attempts"`
+	// NextAttemptAt is when the job is due, nil once it was given up.
+	NextAttemptAt *time.Time `db:"next_attempt_at"`
+	LastError     string     `db:"last_error"`
+}
@@ -1,5 +1,7 @@
 package entities
 
+import "time"
+
 type Person struct {
 	ID          int    `db:"id"`
 	Name        string `db:"name"`
@@ -8,8 +10,45 @@ type Person struct {
 	Age         int    `db:"age"`
 	Gender      string `db:"gender"`
 	Nationality string `db:"nationality"`
+	// CountryID optionally tells the ISO 3166-1 alpha-2 country the person lives in,
+	// which localizes the age and gender estimates.
+	CountryID string `db:"country_id"`
+	// EnrichmentSource sums up where age, gender and nationality came from, api or
+	// offline, or empty when they were entered by hand; see Provenance.Summary.
+	EnrichmentSource string `db:"enrichment_source"`
+	// Provenance tells where each enriched attribute came from and when.
+	Provenance Provenance `db:"provenance"`
+	// EnrichmentStatus follows a person created with asynchronous enrichment, empty
+	// for people enriched before they were stored.
+	EnrichmentStatus string     `db:"enrichment_status"`
+	DeletedAt        *time.Time `db:"deleted_at"`
 }
 
+// Statuses of an asynchronous enrichment.
+const (
+	// EnrichmentStatusPending marks a person stored before being enriched.
+	EnrichmentStatusPending = "pending"
+	// EnrichmentStatusEnriched marks a person enriched after being stored.
+	EnrichmentStatusEnriched = "enriched"
+	// EnrichmentStatusFailed marks a person whose enrichment was given up.
+	EnrichmentStatusFailed = "failed"
+)
+
+// Sources of enriched attributes.
+const (
+	// EnrichmentSourceAPI marks attributes from the provider APIs or their cache.
+	EnrichmentSourceAPI = "api"
+	// EnrichmentSourceOffline marks attributes from the offline name statistics,
+	// which are worth enriching again from the APIs later.
+	EnrichmentSourceOffline = "offline"
+	// EnrichmentSourceCache marks an attribute answered from the cache of provider
+	// results; it is summarized as EnrichmentSourceAPI.
+	EnrichmentSourceCache = "cache"
+	// EnrichmentSourceManual marks an attribute entered by hand, which enrichment never
+	// overwrites.
+	EnrichmentSourceManual = "manual"
+)
+
 func NewPerson(id, age int, name, surname, patronymic, gender, nationality string) *Person {
 	return &Person{
 		ID:          id,
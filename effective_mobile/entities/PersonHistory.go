@@ -0,0 +1,36 @@
+package entities
+
+import "time"
+
+// Actions recorded in the person history.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+// Channels through which a person can be changed.
+const (
+	SourceREST    = "rest"
+	SourceGraphQL = "graphql"
+	SourceKafka   = "kafka"
+)
+
+// ChangeOrigin describes who changed a person and through which channel.
+type ChangeOrigin struct {
+	Actor  string
+	Source string
+}
+
+type PersonHistory struct {
+	ID        int       `db:"id"`
+	PersonID  int       `db:"person_id"`
+	Action    string    `db:"action"`
+	Before    *Person   `db:"before"`
+	After     *Person   `db:"after"`
+	Actor     string    `db:"actor"`
+	Source    string    `db:"source"`
+	ChangedAt time.Time `db:"changed_at"`
+}
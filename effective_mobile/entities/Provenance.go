@@ -0,0 +1,101 @@
+package entities
+
+import "time"
+
+// Attributes filled in by enrichment.
+const (
+	AttributeAge         = "age"
+	AttributeGender      = "gender"
+	AttributeNationality = "nationality"
+)
+
+var Attributes = []string{AttributeAge, AttributeGender, AttributeNationality}
+
+// AttributeProvenance tells where the value of an attribute came from. The zero
+// value means unknown, e.g. for people created before provenance was recorded.
+type AttributeProvenance struct {
+	// Source is one of the EnrichmentSource constants.
+	Source string `json:"source,omitempty"`
+	// Provider is the provider API, or "offline" for the offline statistics.
+	Provider string `json:"provider,omitempty"`
+	// Confidence is the probability the provider gave, 0 when it gives none.
+	Confidence float64 `json:"confidence,omitempty"`
+	// EnrichedAt is when the provider answered, or when the value was entered by hand.
+	EnrichedAt time.Time `json:"enrichedAt"`
+}
+
+// Equal reports whether both describe the same origin, whatever the time zone of EnrichedAt.
+func (p AttributeProvenance) Equal(other AttributeProvenance) bool {
+	return p.Source == other.Source && p.Provider == other.Provider &&
+		p.Confidence == other.Confidence && p.EnrichedAt.Equal(other.EnrichedAt)
+}
+
+// Provenance holds the provenance of each enriched attribute of a person.
+type Provenance struct {
+	Age         AttributeProvenance `json:"age"`
+	Gender      AttributeProvenance `json:"gender"`
+	Nationality AttributeProvenance `json:"nationality"`
+}
+
+// Get returns the provenance of one of the Attributes.
+func (p *Provenance) Get(attribute string) AttributeProvenance {
+	switch attribute {
+	case AttributeAge:
+		return p.Age
+	case AttributeGender:
+		return p.Gender
+	default:
+		return p.Nationality
+	}
+}
+
+// Set records the provenance of one of the Attributes.
+func (p *Provenance) Set(attribute string, provenance AttributeProvenance) {
+	switch attribute {
+	case AttributeAge:
+		p.Age = provenance
+	case AttributeGender:
+		p.Gender = provenance
+	default:
+		p.Nationality = provenance
+	}
+}
+
+// StaleAttributes returns the attributes worth enriching again: those from the
+// offline statistics, and those from the providers enriched before enrichedBefore.
+// Attributes entered by hand or of unknown provenance are never stale.
+func (p *Provenance) StaleAttributes(enrichedBefore time.Time) []string {
+	var stale []string
+	for _, attribute := range Attributes {
+		provenance := p.Get(attribute)
+		switch provenance.Source {
+		case EnrichmentSourceOffline:
+			stale = append(stale, attribute)
+		case EnrichmentSourceAPI, EnrichmentSourceCache:
+			if provenance.EnrichedAt.Before(enrichedBefore) {
+				stale = append(stale, attribute)
+			}
+		}
+	}
+	return stale
+}
+
+// Summary returns the EnrichmentSource of a person with this provenance: offline
+// when any attribute is, api when any came from the providers, empty otherwise.
+func (p *Provenance) Summary() string {
+	summary := ""
+	for _, attribute := range Attributes {
+		switch p.Get(attribute).Source {
+		case EnrichmentSourceOffline:
+			return EnrichmentSourceOffline
+		case EnrichmentSourceAPI, EnrichmentSourceCache:
+			summary = EnrichmentSourceAPI
+		}
+	}
+	return summary
+}
+
+// IsZero reports whether no provenance is known at all.
+func (p *Provenance) IsZero() bool {
+	return *p == Provenance{}
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"effective_mobile/entities"
+	"fmt"
+	"sync"
+)
+
+// Types of person events.
+const (
+	PersonCreated = "created"
+	PersonUpdated = "updated"
+	PersonDeleted = "deleted"
+)
+
+type PersonEvent struct {
+	Type   string
+	Person *entities.Person
+}
+
+// Bus fans person events out to in-process subscribers.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]chan PersonEvent
+	nextID      int
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[int]chan PersonEvent)}
+}
+
+// Subscribe returns a channel receiving every event published from now on and a
+// function that cancels the subscription and closes the channel.
+func (b *Bus) Subscribe(buffer int) (<-chan PersonEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan PersonEvent, buffer)
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers the event to every subscriber without blocking. Subscribers
+// whose buffer is full miss the event, so a slow client cannot stall writes.
+func (b *Bus) Publish(event PersonEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			fmt.Printf("Dropped %s event for person %d: subscriber %d is not keeping up\n", event.Type, event.Person.ID, id)
+		}
+	}
+}
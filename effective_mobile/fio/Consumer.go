@@ -0,0 +1,106 @@
+package fio
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/entities"
+	"effective_mobile/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// FailedTopic receives the FIO messages that could not be turned into a person,
+// with the error_class and error headers explaining why.
+const FailedTopic = "FIO_FAILED"
+
+// DefaultMaxQuotaWait is how long a message waits at most for a provider quota to reset.
+const DefaultMaxQuotaWait = 24 * time.Hour
+
+// Consumer creates an enriched person from every FIO message.
+type Consumer struct {
+	personService service.PersonService
+	producer      sarama.SyncProducer
+	// MaxQuotaWait bounds how long a message waits for an exhausted provider quota to
+	// reset; messages that would wait longer go to FailedTopic.
+	MaxQuotaWait time.Duration
+}
+
+// NewConsumer builds a consumer creating people through personService and sending
+// failed messages to FailedTopic through producer.
+func NewConsumer(personService service.PersonService, producer sarama.SyncProducer) *Consumer {
+	return &Consumer{
+		personService: personService.WithOrigin(entities.ChangeOrigin{Actor: "kafka-consumer", Source: entities.SourceKafka}),
+		producer:      producer,
+		MaxQuotaWait:  DefaultMaxQuotaWait,
+	}
+}
+
+// Run handles messages until the channel is closed.
+func (c *Consumer) Run(messages <-chan *sarama.ConsumerMessage) {
+	for message := range messages {
+		c.Handle(message)
+	}
+}
+
+// Handle processes a single FIO message. While a provider quota is exhausted, it waits
+// for the quota to reset and tries again, so the following messages queue up in Kafka
+// instead of failing.
+func (c *Consumer) Handle(message *sarama.ConsumerMessage) {
+	var inputPerson entities.Person
+	if err := json.Unmarshal(message.Value, &inputPerson); err != nil {
+		fmt.Printf("Error processing message: %v\n", err)
+		c.sendToFailedQueue(message.Value, apperrors.Validation("Invalid JSON format"))
+		return
+	}
+
+	deadline := time.Now().Add(c.MaxQuotaWait)
+	for {
+		person := inputPerson
+		createdPerson, err := c.personService.CreatePersonWithEnrichment(&person, service.DefaultEnrichOptions)
+
+		var quotaErr *enrichment.QuotaExhaustedError
+		if errors.As(err, &quotaErr) && quotaErr.ResetAt.Before(deadline) {
+			fmt.Printf("Deferring %s until the %s quota resets at %s\n", person.Name, quotaErr.Provider, quotaErr.ResetAt.Format(time.RFC3339))
+			time.Sleep(time.Until(quotaErr.ResetAt))
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Error creating person: %v\n", err)
+			c.sendToFailedQueue(message.Value, err)
+			return
+		}
+		fmt.Printf("Created Person: %+v\n", createdPerson)
+		return
+	}
+}
+
+func (c *Consumer) sendToFailedQueue(message []byte, cause error) {
+	kafkaMessage := &sarama.ProducerMessage{
+		Topic: FailedTopic,
+		Value: sarama.StringEncoder(message),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("error_class"), Value: []byte(apperrors.DLQClass(cause))},
+			{Key: []byte("error"), Value: []byte(apperrors.Message(cause))},
+		},
+	}
+
+	partition, offset, err := c.producer.SendMessage(kafkaMessage)
+	if err != nil {
+		fmt.Printf("Error sending message to %s Kafka queue: %v\n", FailedTopic, err)
+		return
+	}
+
+	fmt.Printf("Sent message to %s Kafka queue - Partition: %d, Offset: %d\n", FailedTopic, partition, offset)
+}
+
+// ProducerConfig is the configuration for the producer of failed messages.
+func ProducerConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	// Required by sarama.SyncProducer
+	config.Producer.Return.Successes = true
+	return config
+}
@@ -0,0 +1,85 @@
+package problem
+
+import (
+	"effective_mobile/apperrors"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// New creates a problem of the given status with the generic type for that status.
+func New(status int, detail string) *Problem {
+	return &Problem{
+		Type:   typeFor(status),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// FromError creates a problem from a domain error, including its field-level validation errors.
+func FromError(err error) *Problem {
+	p := New(apperrors.HTTPStatus(err), apperrors.Message(err))
+	if errors.Is(err, apperrors.ErrValidation) {
+		p.Type = "/problems/validation-error"
+	}
+
+	fields := apperrors.FieldErrors(err)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.Errors = append(p.Errors, FieldError{Field: name, Message: fields[name]})
+	}
+
+	return p
+}
+
+// Write sends the problem as application/problem+json, using the request path as its instance.
+func Write(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.RequestURI()
+	}
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+func typeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "/problems/bad-request"
+	case http.StatusForbidden:
+		return "/problems/forbidden"
+	case http.StatusNotFound:
+		return "/problems/not-found"
+	case http.StatusMethodNotAllowed:
+		return "/problems/method-not-allowed"
+	case http.StatusConflict:
+		return "/problems/conflict"
+	case http.StatusServiceUnavailable:
+		return "/problems/upstream-unavailable"
+	default:
+		return "about:blank"
+	}
+}
@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"effective_mobile/entities"
+	"time"
+)
+
+type EnrichmentJobRepository interface {
+	CreateJob(job *entities.EnrichmentJob) error
+	GetJob(personID int) (*entities.EnrichmentJob, error)
+	// ClaimDueJobs returns up to limit jobs due at now and postpones them by lease, so
+	// that no other worker takes them meanwhile and they are taken again if the worker
+	// stops before updating them.
+	ClaimDueJobs(now time.Time, lease time.Duration, limit int) ([]*entities.EnrichmentJob, error)
+	UpdateJob(job *entities.EnrichmentJob) error
+	DeleteJob(personID int) error
+}
@@ -0,0 +1,10 @@
+package repositories
+
+import (
+	"effective_mobile/entities"
+)
+
+type PersonHistoryRepository interface {
+	RecordChange(entry *entities.PersonHistory) error
+	GetHistory(personID int) ([]entities.PersonHistory, error)
+}
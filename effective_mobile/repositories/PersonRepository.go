@@ -2,12 +2,19 @@ package repositories
 
 import (
 	"effective_mobile/entities"
+	"time"
 )
 
 type PersonRepository interface {
 	CreatePerson(person *entities.Person) (*entities.Person, error)
 	GetPersonByID(personID int) (*entities.Person, error)
+	GetPersonByIDIncludingDeleted(personID int) (*entities.Person, error)
+	GetPeopleByIDs(personIDs []int) ([]*entities.Person, error)
 	GetPersonByName(name string) (*entities.Person, error)
+	GetDistinctNames() ([]string, error)
+	GetPeopleToReEnrich(enrichedBefore time.Time, afterID, limit int) ([]*entities.Person, error)
 	UpdatePerson(person *entities.Person) (*entities.Person, error)
-	DeletePerson(personID int) bool
+	DeletePerson(personID int) error
+	RestorePerson(personID int) (*entities.Person, error)
+	PurgeDeletedPeople(deletedBefore time.Time) ([]int, error)
 }
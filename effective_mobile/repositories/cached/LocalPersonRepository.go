@@ -0,0 +1,89 @@
+// Package cached holds PersonRepository decorators that cache the people read from
+// another repository.
+package cached
+
+import (
+	"context"
+	"effective_mobile/cache"
+	"effective_mobile/entities"
+	"effective_mobile/repositories"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// personNamespace is the namespace of people in cache invalidations.
+const personNamespace = "person"
+
+// LocalConfig configures the in-process person cache.
+type LocalConfig struct {
+	// Size is how many people are kept; below 1 disables the cache.
+	Size int
+	// TTL bounds how long a person is served without reading the wrapped repository.
+	TTL time.Duration
+}
+
+// LocalPersonRepository keeps the people read by ID in process memory. Updates and
+// deletions made through it drop the cached person here and, through the invalidator,
+// on the other replicas. Deleted people are never cached, so restoring or purging
+// them needs no invalidation. Every other method goes straight to the wrapped
+// repository.
+type LocalPersonRepository struct {
+	repositories.PersonRepository
+	people      *cache.LRU[int, entities.Person]
+	invalidator *cache.Invalidator
+	// generation changes on every invalidation, so a read that raced with a change
+	// does not cache the person as it was before
+	generation uint64
+}
+
+func NewLocalPersonRepository(personRepository repositories.PersonRepository, config LocalConfig, invalidator *cache.Invalidator) *LocalPersonRepository {
+	r := &LocalPersonRepository{
+		PersonRepository: personRepository,
+		people:           cache.NewLRU[int, entities.Person](config.Size, config.TTL),
+		invalidator:      invalidator,
+	}
+	invalidator.Subscribe(personNamespace, func(key string) {
+		if personID, err := strconv.Atoi(key); err == nil {
+			r.forget(personID)
+		}
+	})
+	return r
+}
+
+func (r *LocalPersonRepository) GetPersonByID(personID int) (*entities.Person, error) {
+	if person, ok := r.people.Get(personID); ok {
+		return &person, nil
+	}
+
+	generation := atomic.LoadUint64(&r.generation)
+	person, err := r.PersonRepository.GetPersonByID(personID)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.LoadUint64(&r.generation) == generation {
+		r.people.Set(personID, *person)
+	}
+	return person, nil
+}
+
+func (r *LocalPersonRepository) UpdatePerson(person *entities.Person) (*entities.Person, error) {
+	defer r.invalidate(person.ID)
+	return r.PersonRepository.UpdatePerson(person)
+}
+
+func (r *LocalPersonRepository) DeletePerson(personID int) error {
+	defer r.invalidate(personID)
+	return r.PersonRepository.DeletePerson(personID)
+}
+
+// invalidate drops a changed person here and on the other replicas.
+func (r *LocalPersonRepository) invalidate(personID int) {
+	r.forget(personID)
+	r.invalidator.Publish(context.Background(), personNamespace, strconv.Itoa(personID))
+}
+
+func (r *LocalPersonRepository) forget(personID int) {
+	atomic.AddUint64(&r.generation, 1)
+	r.people.Delete(personID)
+}
@@ -0,0 +1,226 @@
+package cached
+
+import (
+	"context"
+	"effective_mobile/cache"
+	"effective_mobile/entities"
+	"effective_mobile/repositories"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// RedisConfig configures the Redis person cache.
+type RedisConfig struct {
+	// KeyPrefix namespaces the cache keys; bump its version when the entry format changes.
+	KeyPrefix string
+	// TTL is how long a person stays cached; each entry gets up to 10% more so that
+	// entries cached together do not expire together.
+	TTL time.Duration
+	// Timeout bounds every Redis call; a failing Redis is skipped for a while.
+	Timeout time.Duration
+}
+
+// DefaultRedisConfig is used for the RedisConfig fields left zero.
+var DefaultRedisConfig = RedisConfig{
+	KeyPrefix: "person:v2:",
+	TTL:       10 * time.Minute,
+	Timeout:   200 * time.Millisecond,
+}
+
+// redisCooldown is how long Redis is skipped after a failed call.
+const redisCooldown = 5 * time.Second
+
+// RedisPersonRepository caches the people read by ID and name in Redis, shared by
+// every replica. Lookups by name cache the ID of the person, so a rename or deletion
+// only has to invalidate the person itself. Concurrent misses of the same key share
+// one read of the wrapped repository. When Redis fails, reads go straight to the
+// wrapped repository.
+type RedisPersonRepository struct {
+	repositories.PersonRepository
+	redisClient *redis.Client
+	config      RedisConfig
+	breaker     *cache.Breaker
+	flights     singleflight.Group
+}
+
+func NewRedisPersonRepository(personRepository repositories.PersonRepository, redisClient *redis.Client, config RedisConfig) *RedisPersonRepository {
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = DefaultRedisConfig.KeyPrefix
+	}
+	if config.TTL == 0 {
+		config.TTL = DefaultRedisConfig.TTL
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultRedisConfig.Timeout
+	}
+
+	return &RedisPersonRepository{
+		PersonRepository: personRepository,
+		redisClient:      redisClient,
+		config:           config,
+		breaker:          cache.NewBreaker(redisCooldown),
+	}
+}
+
+func (r *RedisPersonRepository) GetPersonByID(personID int) (*entities.Person, error) {
+	data, err := r.readThrough(r.idKey(personID), func() (string, error) {
+		person, err := r.PersonRepository.GetPersonByID(personID)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(person)
+		return string(data), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var person entities.Person
+	if err := json.Unmarshal([]byte(data), &person); err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
+
+func (r *RedisPersonRepository) GetPersonByName(name string) (*entities.Person, error) {
+	id, err := r.readThrough(r.nameKey(name), func() (string, error) {
+		person, err := r.PersonRepository.GetPersonByName(name)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(person.ID), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	personID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+	// The person may have been renamed or deleted since
+	person, err := r.GetPersonByID(personID)
+	if err != nil || person.Name != name {
+		return r.PersonRepository.GetPersonByName(name)
+	}
+	return person, nil
+}
+
+func (r *RedisPersonRepository) UpdatePerson(person *entities.Person) (*entities.Person, error) {
+	updated, err := r.PersonRepository.UpdatePerson(person)
+	// The person may now be the first one with its new name
+	r.invalidate(r.idKey(person.ID), r.nameKey(person.Name))
+	return updated, err
+}
+
+func (r *RedisPersonRepository) DeletePerson(personID int) error {
+	err := r.PersonRepository.DeletePerson(personID)
+	r.invalidate(r.idKey(personID))
+	return err
+}
+
+func (r *RedisPersonRepository) RestorePerson(personID int) (*entities.Person, error) {
+	restored, err := r.PersonRepository.RestorePerson(personID)
+	if err == nil {
+		// The restored person may be the first one with its name again
+		r.invalidate(r.idKey(personID), r.nameKey(restored.Name))
+	}
+	return restored, err
+}
+
+// readThrough returns the cached value of key, loading and caching it on a miss. The
+// value is only cached when the key was not invalidated while it was loaded, so a
+// read racing with a change cannot cache what the change replaced.
+func (r *RedisPersonRepository) readThrough(key string, load func() (string, error)) (string, error) {
+	if !r.breaker.Allow() {
+		return load()
+	}
+
+	value, err, _ := r.flights.Do(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), r.config.Timeout)
+		value, err := r.redisClient.Get(ctx, key).Result()
+		cancel()
+		r.breaker.Report(err)
+		if err == nil {
+			return value, nil
+		}
+		if err != redis.Nil {
+			fmt.Printf("Failed to read %s from Redis: %v\n", key, err)
+			return load()
+		}
+
+		var loaded string
+		var loadErr error
+		attempted := false
+		err = r.redisClient.Watch(context.Background(), func(tx *redis.Tx) error {
+			// The version is watched by now: an invalidation from here on fails the transaction
+			attempted = true
+			loaded, loadErr = load()
+			if loadErr != nil {
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), r.config.Timeout)
+			defer cancel()
+			_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, loaded, r.ttl())
+				return nil
+			})
+			return err
+		}, versionKey(key))
+		r.breaker.Report(err)
+		if err != nil && err != redis.TxFailedErr {
+			fmt.Printf("Failed to cache %s in Redis: %v\n", key, err)
+		}
+		if !attempted {
+			return load()
+		}
+		return loaded, loadErr
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// invalidate drops the keys after a change, bumping their versions so that reads
+// already in flight do not cache them again.
+func (r *RedisPersonRepository) invalidate(keys ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.Timeout)
+	defer cancel()
+
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Incr(ctx, versionKey(key))
+			pipe.Expire(ctx, versionKey(key), r.config.TTL)
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	r.breaker.Report(err)
+	if err != nil {
+		fmt.Printf("Failed to invalidate %v in Redis: %v\n", keys, err)
+	}
+}
+
+func (r *RedisPersonRepository) ttl() time.Duration {
+	return r.config.TTL + time.Duration(rand.Int63n(int64(r.config.TTL)/10+1))
+}
+
+func (r *RedisPersonRepository) idKey(personID int) string {
+	return r.config.KeyPrefix + "id:" + strconv.Itoa(personID)
+}
+
+func (r *RedisPersonRepository) nameKey(name string) string {
+	return r.config.KeyPrefix + "name:" + name
+}
+
+func versionKey(key string) string {
+	return key + ":version"
+}
@@ -0,0 +1,120 @@
+package impl
+
+import (
+	"database/sql"
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const enrichmentJobColumns = "person_id, skip_providers, webhook_url, attempts, next_attempt_at, last_error"
+
+type EnrichmentJobRepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewEnrichmentJobRepository(db *sql.DB) *EnrichmentJobRepositoryImpl {
+	return &EnrichmentJobRepositoryImpl{db: db}
+}
+
+func (r *EnrichmentJobRepositoryImpl) CreateJob(job *entities.EnrichmentJob) error {
+	insertQuery := `
+		INSERT INTO enrichment_jobs (` + enrichmentJobColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(insertQuery, job.PersonID, skipProvidersArray(job.SkipProviders), job.WebhookURL, job.Attempts, job.NextAttemptAt, job.LastError)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return apperrors.Conflict(err, "Enrichment job already exists")
+		}
+		return apperrors.Upstream(err, "Error creating enrichment job")
+	}
+	return nil
+}
+
+func (r *EnrichmentJobRepositoryImpl) GetJob(personID int) (*entities.EnrichmentJob, error) {
+	query := "SELECT " + enrichmentJobColumns + " FROM enrichment_jobs WHERE person_id = $1"
+	return scanEnrichmentJob(r.db.QueryRow(query, personID))
+}
+
+// ClaimDueJobs skips the jobs other workers are claiming at the same time, so that
+// each job is taken by a single worker.
+func (r *EnrichmentJobRepositoryImpl) ClaimDueJobs(now time.Time, lease time.Duration, limit int) ([]*entities.EnrichmentJob, error) {
+	query := `
+		UPDATE enrichment_jobs SET next_attempt_at = $2
+		WHERE person_id IN (
+			SELECT person_id FROM enrichment_jobs
+			WHERE next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + enrichmentJobColumns
+
+	rows, err := r.db.Query(query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, apperrors.Upstream(err, "Error claiming enrichment jobs")
+	}
+	defer rows.Close()
+
+	var jobs []*entities.EnrichmentJob
+	for rows.Next() {
+		job, err := scanEnrichmentJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.Upstream(err, "Error claiming enrichment jobs")
+	}
+	return jobs, nil
+}
+
+func (r *EnrichmentJobRepositoryImpl) UpdateJob(job *entities.EnrichmentJob) error {
+	query := `
+		UPDATE enrichment_jobs
+		SET skip_providers = $1, webhook_url = $2, attempts = $3, next_attempt_at = $4, last_error = $5
+		WHERE person_id = $6
+	`
+	result, err := r.db.Exec(query, skipProvidersArray(job.SkipProviders), job.WebhookURL, job.Attempts, job.NextAttemptAt, job.LastError, job.PersonID)
+	if err != nil {
+		return apperrors.Upstream(err, "Error updating enrichment job")
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.Upstream(err, "Error updating enrichment job")
+	}
+	if rowsAffected == 0 {
+		return apperrors.NotFound("Enrichment job not found")
+	}
+	return nil
+}
+
+func (r *EnrichmentJobRepositoryImpl) DeleteJob(personID int) error {
+	if _, err := r.db.Exec("DELETE FROM enrichment_jobs WHERE person_id = $1", personID); err != nil {
+		return apperrors.Upstream(err, "Error deleting enrichment job")
+	}
+	return nil
+}
+
+// skipProvidersArray binds the skipped providers as a TEXT[], never NULL.
+func skipProvidersArray(providers []string) interface{} {
+	return pq.Array(append([]string{}, providers...))
+}
+
+func scanEnrichmentJob(row rowScanner) (*entities.EnrichmentJob, error) {
+	var job entities.EnrichmentJob
+	err := row.Scan(&job.PersonID, pq.Array(&job.SkipProviders), &job.WebhookURL, &job.Attempts, &job.NextAttemptAt, &job.LastError)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NotFound("Enrichment job not found")
+		}
+		return nil, apperrors.Upstream(err, "Error fetching enrichment job")
+	}
+	return &job, nil
+}
@@ -0,0 +1,102 @@
+package impl
+
+import (
+	"database/sql"
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"encoding/json"
+)
+
+type PersonHistoryRepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewPersonHistoryRepository(db *sql.DB) *PersonHistoryRepositoryImpl {
+	return &PersonHistoryRepositoryImpl{db: db}
+}
+
+func (r *PersonHistoryRepositoryImpl) RecordChange(entry *entities.PersonHistory) error {
+	before, err := marshalSnapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalSnapshot(entry.After)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO person_history (person_id, action, before, after, actor, source, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	err = r.db.QueryRow(insertQuery, entry.PersonID, entry.Action, before, after, entry.Actor, entry.Source, entry.ChangedAt).Scan(&entry.ID)
+	if err != nil {
+		return apperrors.Upstream(err, "Error recording person history")
+	}
+	return nil
+}
+
+func (r *PersonHistoryRepositoryImpl) GetHistory(personID int) ([]entities.PersonHistory, error) {
+	query := `
+		SELECT id, person_id, action, before, after, actor, source, changed_at
+		FROM person_history
+		WHERE person_id = $1
+		ORDER BY changed_at, id
+	`
+
+	rows, err := r.db.Query(query, personID)
+	if err != nil {
+		return nil, apperrors.Upstream(err, "Error fetching person history")
+	}
+	defer rows.Close()
+
+	history := []entities.PersonHistory{}
+	for rows.Next() {
+		var entry entities.PersonHistory
+		var before, after []byte
+		err := rows.Scan(&entry.ID, &entry.PersonID, &entry.Action, &before, &after, &entry.Actor, &entry.Source, &entry.ChangedAt)
+		if err != nil {
+			return nil, apperrors.Upstream(err, "Error fetching person history")
+		}
+
+		if entry.Before, err = unmarshalSnapshot(before); err != nil {
+			return nil, err
+		}
+		if entry.After, err = unmarshalSnapshot(after); err != nil {
+			return nil, err
+		}
+
+		history = append(history, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.Upstream(err, "Error fetching person history")
+	}
+	return history, nil
+}
+
+// marshalSnapshot encodes a person snapshot for a JSONB column, keeping a missing snapshot as NULL.
+func marshalSnapshot(person *entities.Person) (interface{}, error) {
+	if person == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(person)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func unmarshalSnapshot(data []byte) (*entities.Person, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	var person entities.Person
+	if err := json.Unmarshal(data, &person); err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
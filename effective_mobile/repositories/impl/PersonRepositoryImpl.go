@@ -2,10 +2,17 @@ package impl
 
 import (
 	"database/sql"
+	"effective_mobile/apperrors"
 	"effective_mobile/entities"
+	"encoding/json"
 	"errors"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+const personColumns = "id, name, surname, patronymic, age, gender, nationality, country_id, enrichment_source, provenance, enrichment_status, deleted_at"
+
 type PersonRepositoryImpl struct {
 	db *sql.DB
 }
@@ -15,20 +22,23 @@ func NewPersonRepository(db *sql.DB) *PersonRepositoryImpl {
 }
 
 func (r *PersonRepositoryImpl) CreatePerson(person *entities.Person) (*entities.Person, error) {
-	// Insert the person without the RETURNING clause
+	// LASTVAL() would be unreliable here: the pool may run it on another connection than the INSERT
 	insertQuery := `
-		INSERT INTO persons (name, surname, patronymic, age, gender, nationality)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO persons (name, surname, patronymic, age, gender, nationality, country_id, enrichment_source, provenance, enrichment_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
 	`
-	_, err := r.db.Exec(insertQuery, person.Name, person.Surname, person.Patronymic, person.Age, person.Gender, person.Nationality)
+	provenance, err := json.Marshal(person.Provenance)
 	if err != nil {
 		return nil, err
 	}
-
 	var id int
-	err = r.db.QueryRow("SELECT LASTVAL()").Scan(&id)
+	err = r.db.QueryRow(insertQuery, person.Name, person.Surname, person.Patronymic, person.Age, person.Gender, person.Nationality, person.CountryID, person.EnrichmentSource, provenance, person.EnrichmentStatus).Scan(&id)
 	if err != nil {
-		return nil, err
+		if isUniqueViolation(err) {
+			return nil, apperrors.Conflict(err, "Person already exists")
+		}
+		return nil, apperrors.Upstream(err, "Error creating person")
 	}
 
 	person.ID = id
@@ -36,62 +46,216 @@ func (r *PersonRepositoryImpl) CreatePerson(person *entities.Person) (*entities.
 }
 
 func (r *PersonRepositoryImpl) GetPersonByID(personID int) (*entities.Person, error) {
-	query := "SELECT id, name, surname, patronymic, age, gender, nationality FROM persons WHERE id = $1"
+	query := "SELECT " + personColumns + " FROM persons WHERE id = $1 AND deleted_at IS NULL"
+	return scanPerson(r.db.QueryRow(query, personID))
+}
 
-	var person entities.Person
-	err := r.db.QueryRow(query, personID).Scan(&person.ID, &person.Name, &person.Surname, &person.Patronymic, &person.Age, &person.Gender, &person.Nationality)
+func (r *PersonRepositoryImpl) GetPersonByIDIncludingDeleted(personID int) (*entities.Person, error) {
+	query := "SELECT " + personColumns + " FROM persons WHERE id = $1"
+	return scanPerson(r.db.QueryRow(query, personID))
+}
+
+// GetPeopleByIDs returns the people with the given IDs that exist, in no particular order.
+func (r *PersonRepositoryImpl) GetPeopleByIDs(personIDs []int) ([]*entities.Person, error) {
+	query := "SELECT " + personColumns + " FROM persons WHERE id = ANY($1) AND deleted_at IS NULL"
+
+	rows, err := r.db.Query(query, pq.Array(personIDs))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil // Person not found
+		return nil, apperrors.Upstream(err, "Error fetching people")
+	}
+	defer rows.Close()
+
+	var people []*entities.Person
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, err
 		}
-		return nil, err
+		people = append(people, person)
 	}
 
-	return &person, nil
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.Upstream(err, "Error fetching people")
+	}
+	return people, nil
 }
 
-func (r *PersonRepositoryImpl) GetPersonByName(name string) (*entities.Person, error) {
-	query := "SELECT id, name, surname, patronymic, age, gender, nationality FROM persons WHERE name = $1"
+// GetDistinctNames returns the names of the live people, sorted and without duplicates.
+func (r *PersonRepositoryImpl) GetDistinctNames() ([]string, error) {
+	rows, err := r.db.Query("SELECT DISTINCT name FROM persons WHERE deleted_at IS NULL ORDER BY name")
+	if err != nil {
+		return nil, apperrors.Upstream(err, "Error fetching names")
+	}
+	defer rows.Close()
 
-	var person entities.Person
-	err := r.db.QueryRow(query, name).Scan(&person.ID, &person.Name, &person.Surname, &person.Patronymic, &person.Age, &person.Gender, &person.Nationality)
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, apperrors.Upstream(err, "Error fetching names")
+		}
+		names = append(names, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.Upstream(err, "Error fetching names")
+	}
+	return names, nil
+}
+
+// GetPeopleToReEnrich returns up to limit live people with an ID above afterID, ordered
+// by ID, that have an attribute from the offline statistics or one enriched from the
+// providers before enrichedBefore; see Provenance.StaleAttributes.
+func (r *PersonRepositoryImpl) GetPeopleToReEnrich(enrichedBefore time.Time, afterID, limit int) ([]*entities.Person, error) {
+	query := `
+		SELECT ` + personColumns + ` FROM persons
+		WHERE deleted_at IS NULL AND id > $2 AND EXISTS (
+			SELECT 1 FROM jsonb_each(provenance) AS attribute(name, value)
+			WHERE value->>'source' = 'offline'
+			   OR (value->>'source' IN ('api', 'cache') AND (value->>'enrichedAt')::timestamptz < $1)
+		)
+		ORDER BY id
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(query, enrichedBefore, afterID, limit)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil // Person not found
+		return nil, apperrors.Upstream(err, "Error fetching people to re-enrich")
+	}
+	defer rows.Close()
+
+	var people []*entities.Person
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, err
 		}
-		return nil, err
+		people = append(people, person)
 	}
 
-	return &person, nil
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.Upstream(err, "Error fetching people to re-enrich")
+	}
+	return people, nil
+}
+
+func (r *PersonRepositoryImpl) GetPersonByName(name string) (*entities.Person, error) {
+	// Namesakes are allowed, the first one created is returned
+	query := "SELECT " + personColumns + " FROM persons WHERE name = $1 AND deleted_at IS NULL ORDER BY id LIMIT 1"
+	return scanPerson(r.db.QueryRow(query, name))
 }
 
 func (r *PersonRepositoryImpl) UpdatePerson(person *entities.Person) (*entities.Person, error) {
 	query := `
 		UPDATE persons
-		SET name = $1, surname = $2, patronymic = $3, age = $4, gender = $5, nationality = $6
-		WHERE id = $7
+		SET name = $1, surname = $2, patronymic = $3, age = $4, gender = $5, nationality = $6, country_id = $7, enrichment_source = $8, provenance = $9, enrichment_status = $10
+		WHERE id = $11 AND deleted_at IS NULL
 	`
 
-	_, err := r.db.Exec(query, person.Name, person.Surname, person.Patronymic, person.Age, person.Gender, person.Nationality, person.ID)
+	provenance, err := json.Marshal(person.Provenance)
 	if err != nil {
 		return nil, err
 	}
+	result, err := r.db.Exec(query, person.Name, person.Surname, person.Patronymic, person.Age, person.Gender, person.Nationality, person.CountryID, person.EnrichmentSource, provenance, person.EnrichmentStatus, person.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, apperrors.Conflict(err, "Person already exists")
+		}
+		return nil, apperrors.Upstream(err, "Error updating person")
+	}
+
+	if err := requireAffected(result, "Error updating person"); err != nil {
+		return nil, err
+	}
 
 	return person, nil
 }
 
-func (r *PersonRepositoryImpl) DeletePerson(personID int) bool {
-	query := "DELETE FROM persons WHERE id = $1"
+// DeletePerson soft-deletes the person; the row is removed for good by PurgeDeletedPeople.
+func (r *PersonRepositoryImpl) DeletePerson(personID int) error {
+	query := "UPDATE persons SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL"
 
 	result, err := r.db.Exec(query, personID)
 	if err != nil {
-		return false
+		return apperrors.Upstream(err, "Error deleting person")
+	}
+
+	return requireAffected(result, "Error deleting person")
+}
+
+func (r *PersonRepositoryImpl) RestorePerson(personID int) (*entities.Person, error) {
+	query := "UPDATE persons SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING " + personColumns
+	restored, err := scanPerson(r.db.QueryRow(query, personID))
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		return restored, err
+	}
+
+	// Nothing was restored, either because the person does not exist or is not deleted
+	if _, err := r.GetPersonByID(personID); err != nil {
+		return nil, err
+	}
+	return nil, apperrors.Conflict(nil, "Person is not deleted")
+}
+
+func (r *PersonRepositoryImpl) PurgeDeletedPeople(deletedBefore time.Time) ([]int, error) {
+	query := "DELETE FROM persons WHERE deleted_at IS NOT NULL AND deleted_at < $1 RETURNING id"
+
+	rows, err := r.db.Query(query, deletedBefore)
+	if err != nil {
+		return nil, apperrors.Upstream(err, "Error purging deleted people")
+	}
+	defer rows.Close()
+
+	var purgedIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, apperrors.Upstream(err, "Error purging deleted people")
+		}
+		purgedIDs = append(purgedIDs, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.Upstream(err, "Error purging deleted people")
+	}
+	return purgedIDs, nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPerson(row rowScanner) (*entities.Person, error) {
+	var person entities.Person
+	var provenance []byte
+	err := row.Scan(&person.ID, &person.Name, &person.Surname, &person.Patronymic, &person.Age, &person.Gender, &person.Nationality, &person.CountryID, &person.EnrichmentSource, &provenance, &person.EnrichmentStatus, &person.DeletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NotFound("Person not found")
+		}
+		return nil, apperrors.Upstream(err, "Error fetching person")
+	}
+	if err := json.Unmarshal(provenance, &person.Provenance); err != nil {
+		return nil, apperrors.Upstream(err, "Error fetching person")
 	}
 
+	return &person, nil
+}
+
+// requireAffected turns an update that matched no rows into a not-found error.
+func requireAffected(result sql.Result, message string) error {
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return false
+		return apperrors.Upstream(err, message)
 	}
+	if rowsAffected == 0 {
+		return apperrors.NotFound("Person not found")
+	}
+	return nil
+}
 
-	return rowsAffected > 0
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EnrichmentJobRepository keeps the enrichment jobs in memory. It is safe for concurrent use.
+type EnrichmentJobRepository struct {
+	mu   sync.Mutex
+	jobs map[int]entities.EnrichmentJob
+}
+
+func NewEnrichmentJobRepository() *EnrichmentJobRepository {
+	return &EnrichmentJobRepository{jobs: make(map[int]entities.EnrichmentJob)}
+}
+
+func (r *EnrichmentJobRepository) CreateJob(job *entities.EnrichmentJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.jobs[job.PersonID]; ok {
+		return apperrors.Conflict(nil, "Enrichment job already exists")
+	}
+	r.jobs[job.PersonID] = copyJob(job)
+	return nil
+}
+
+func (r *EnrichmentJobRepository) GetJob(personID int) (*entities.EnrichmentJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[personID]
+	if !ok {
+		return nil, apperrors.NotFound("Enrichment job not found")
+	}
+	job = copyJob(&job)
+	return &job, nil
+}
+
+// ClaimDueJobs returns the due jobs in the order they are due.
+func (r *EnrichmentJobRepository) ClaimDueJobs(now time.Time, lease time.Duration, limit int) ([]*entities.EnrichmentJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []entities.EnrichmentJob
+	for _, job := range r.jobs {
+		if job.NextAttemptAt != nil && !job.NextAttemptAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	leasedUntil := now.Add(lease)
+	jobs := make([]*entities.EnrichmentJob, 0, len(due))
+	for _, job := range due {
+		job.NextAttemptAt = &leasedUntil
+		r.jobs[job.PersonID] = copyJob(&job)
+		claimed := copyJob(&job)
+		jobs = append(jobs, &claimed)
+	}
+	return jobs, nil
+}
+
+func (r *EnrichmentJobRepository) UpdateJob(job *entities.EnrichmentJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.jobs[job.PersonID]; !ok {
+		return apperrors.NotFound("Enrichment job not found")
+	}
+	r.jobs[job.PersonID] = copyJob(job)
+	return nil
+}
+
+func (r *EnrichmentJobRepository) DeleteJob(personID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.jobs, personID)
+	return nil
+}
+
+// copyJob detaches a stored job from the slice and time the caller may modify.
+func copyJob(job *entities.EnrichmentJob) entities.EnrichmentJob {
+	stored := *job
+	stored.SkipProviders = append([]string(nil), job.SkipProviders...)
+	if job.NextAttemptAt != nil {
+		nextAttemptAt := *job.NextAttemptAt
+		stored.NextAttemptAt = &nextAttemptAt
+	}
+	return stored
+}
@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"effective_mobile/entities"
+	"sync"
+)
+
+// PersonHistoryRepository keeps the change history in memory. It is safe for concurrent use.
+type PersonHistoryRepository struct {
+	mu      sync.RWMutex
+	entries []entities.PersonHistory
+}
+
+func NewPersonHistoryRepository() *PersonHistoryRepository {
+	return &PersonHistoryRepository{}
+}
+
+func (r *PersonHistoryRepository) RecordChange(entry *entities.PersonHistory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.ID = len(r.entries) + 1
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+// GetHistory returns the changes of a person in the order they were recorded.
+func (r *PersonHistoryRepository) GetHistory(personID int) ([]entities.PersonHistory, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := []entities.PersonHistory{}
+	for _, entry := range r.entries {
+		if entry.PersonID == personID {
+			history = append(history, entry)
+		}
+	}
+	return history, nil
+}
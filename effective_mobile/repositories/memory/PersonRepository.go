@@ -0,0 +1,200 @@
+package memory
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PersonRepository keeps people in memory with the same semantics as the Postgres
+// repository, including soft deletion. It is safe for concurrent use.
+type PersonRepository struct {
+	mu     sync.RWMutex
+	people map[int]entities.Person
+	nextID int
+}
+
+func NewPersonRepository() *PersonRepository {
+	return &PersonRepository{people: make(map[int]entities.Person), nextID: 1}
+}
+
+func (r *PersonRepository) CreatePerson(person *entities.Person) (*entities.Person, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	person.ID = r.nextID
+	person.DeletedAt = nil
+	r.nextID++
+	r.people[person.ID] = *person
+	return person, nil
+}
+
+func (r *PersonRepository) GetPersonByID(personID int) (*entities.Person, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	person, ok := r.people[personID]
+	if !ok || person.DeletedAt != nil {
+		return nil, apperrors.NotFound("Person not found")
+	}
+	return &person, nil
+}
+
+func (r *PersonRepository) GetPersonByIDIncludingDeleted(personID int) (*entities.Person, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	person, ok := r.people[personID]
+	if !ok {
+		return nil, apperrors.NotFound("Person not found")
+	}
+	return &person, nil
+}
+
+// GetPeopleByIDs returns the people with the given IDs that exist, ordered by ID.
+func (r *PersonRepository) GetPeopleByIDs(personIDs []int) ([]*entities.Person, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var people []*entities.Person
+	seen := make(map[int]bool, len(personIDs))
+	for _, personID := range personIDs {
+		person, ok := r.people[personID]
+		if !ok || person.DeletedAt != nil || seen[personID] {
+			continue
+		}
+		seen[personID] = true
+		people = append(people, &person)
+	}
+
+	sort.Slice(people, func(i, j int) bool { return people[i].ID < people[j].ID })
+	return people, nil
+}
+
+// GetDistinctNames returns the names of the live people, sorted and without duplicates.
+func (r *PersonRepository) GetDistinctNames() ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, person := range r.people {
+		if person.DeletedAt == nil && !seen[person.Name] {
+			seen[person.Name] = true
+			names = append(names, person.Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetPeopleToReEnrich returns up to limit live people with an ID above afterID, ordered
+// by ID, that have attributes worth enriching again; see Provenance.StaleAttributes.
+func (r *PersonRepository) GetPeopleToReEnrich(enrichedBefore time.Time, afterID, limit int) ([]*entities.Person, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var people []*entities.Person
+	for _, person := range r.people {
+		if person.DeletedAt != nil || person.ID <= afterID || len(person.Provenance.StaleAttributes(enrichedBefore)) == 0 {
+			continue
+		}
+		match := person
+		people = append(people, &match)
+	}
+
+	sort.Slice(people, func(i, j int) bool { return people[i].ID < people[j].ID })
+	if len(people) > limit {
+		people = people[:limit]
+	}
+	return people, nil
+}
+
+// GetPersonByName returns the person with the lowest ID among those with the name.
+func (r *PersonRepository) GetPersonByName(name string) (*entities.Person, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var found *entities.Person
+	for _, person := range r.people {
+		if person.Name != name || person.DeletedAt != nil {
+			continue
+		}
+		if found == nil || person.ID < found.ID {
+			match := person
+			found = &match
+		}
+	}
+
+	if found == nil {
+		return nil, apperrors.NotFound("Person not found")
+	}
+	return found, nil
+}
+
+func (r *PersonRepository) UpdatePerson(person *entities.Person) (*entities.Person, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.people[person.ID]
+	if !ok || stored.DeletedAt != nil {
+		return nil, apperrors.NotFound("Person not found")
+	}
+
+	updated := *person
+	updated.DeletedAt = nil
+	r.people[person.ID] = updated
+	return person, nil
+}
+
+// DeletePerson soft-deletes the person; the person is removed for good by PurgeDeletedPeople.
+func (r *PersonRepository) DeletePerson(personID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	person, ok := r.people[personID]
+	if !ok || person.DeletedAt != nil {
+		return apperrors.NotFound("Person not found")
+	}
+
+	deletedAt := time.Now()
+	person.DeletedAt = &deletedAt
+	r.people[personID] = person
+	return nil
+}
+
+func (r *PersonRepository) RestorePerson(personID int) (*entities.Person, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	person, ok := r.people[personID]
+	if !ok {
+		return nil, apperrors.NotFound("Person not found")
+	}
+	if person.DeletedAt == nil {
+		return nil, apperrors.Conflict(nil, "Person is not deleted")
+	}
+
+	person.DeletedAt = nil
+	r.people[personID] = person
+	return &person, nil
+}
+
+func (r *PersonRepository) PurgeDeletedPeople(deletedBefore time.Time) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purgedIDs []int
+	for personID, person := range r.people {
+		if person.DeletedAt != nil && person.DeletedAt.Before(deletedBefore) {
+			delete(r.people, personID)
+			purgedIDs = append(purgedIDs, personID)
+		}
+	}
+
+	sort.Ints(purgedIDs)
+	return purgedIDs, nil
+}
@@ -0,0 +1,313 @@
+// Package repositorytest holds conformance suites that every repository implementation
+// must pass, so the Postgres and in-memory backends cannot drift apart.
+package repositorytest
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"effective_mobile/repositories"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RunPersonRepositoryContract runs the PersonRepository contract. newRepository must
+// return an empty repository for each subtest.
+func RunPersonRepositoryContract(t *testing.T, newRepository func(t *testing.T) repositories.PersonRepository) {
+	enrichedAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repository := newRepository(t)
+
+		john := createPerson(t, repository, &entities.Person{
+			Name: "John", Surname: "Doe", Patronymic: "Adam", Age: 42, Gender: "male", Nationality: "US", CountryID: "US",
+			EnrichmentSource: entities.EnrichmentSourceAPI,
+			Provenance: entities.Provenance{
+				Age:         entities.AttributeProvenance{Source: entities.EnrichmentSourceAPI, Provider: "agify", EnrichedAt: enrichedAt},
+				Gender:      entities.AttributeProvenance{Source: entities.EnrichmentSourceCache, Provider: "genderize", Confidence: 0.99, EnrichedAt: enrichedAt},
+				Nationality: entities.AttributeProvenance{Source: entities.EnrichmentSourceManual, EnrichedAt: enrichedAt},
+			},
+			EnrichmentStatus: entities.EnrichmentStatusPending,
+		})
+		jane := createPerson(t, repository, &entities.Person{Name: "Jane", Surname: "Doe"})
+		if john.ID == 0 || john.ID == jane.ID {
+			t.Fatalf("Expected distinct IDs, got %d and %d", john.ID, jane.ID)
+		}
+		createPerson(t, repository, &entities.Person{Name: "Jane", Surname: "Smith"})
+
+		person, err := repository.GetPersonByID(john.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expectSamePerson(t, john, person)
+
+		// The first of the namesakes is returned
+		person, err = repository.GetPersonByName("Jane")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expectSamePerson(t, jane, person)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repository := newRepository(t)
+
+		_, err := repository.GetPersonByID(404)
+		expectNotFound(t, "GetPersonByID", err)
+		_, err = repository.GetPersonByIDIncludingDeleted(404)
+		expectNotFound(t, "GetPersonByIDIncludingDeleted", err)
+		_, err = repository.GetPersonByName("Nobody")
+		expectNotFound(t, "GetPersonByName", err)
+		_, err = repository.UpdatePerson(&entities.Person{ID: 404, Name: "John", Surname: "Doe"})
+		expectNotFound(t, "UpdatePerson", err)
+		expectNotFound(t, "DeletePerson", repository.DeletePerson(404))
+		_, err = repository.RestorePerson(404)
+		expectNotFound(t, "RestorePerson", err)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repository := newRepository(t)
+		created := createPerson(t, repository, &entities.Person{Name: "John", Surname: "Doe"})
+
+		change := &entities.Person{
+			ID: created.ID, Name: "Johnny", Surname: "Smith", Age: 30, Gender: "male", Nationality: "GB",
+			EnrichmentSource: entities.EnrichmentSourceOffline,
+			EnrichmentStatus: entities.EnrichmentStatusEnriched,
+		}
+		change.Provenance.Age = entities.AttributeProvenance{Source: entities.EnrichmentSourceOffline, Provider: "offline", Confidence: 0.5, EnrichedAt: enrichedAt}
+		if _, err := repository.UpdatePerson(change); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		person, err := repository.GetPersonByID(created.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expectSamePerson(t, change, person)
+
+		_, err = repository.GetPersonByName("John")
+		expectNotFound(t, "GetPersonByName after rename", err)
+	})
+
+	t.Run("SoftDeleteAndRestore", func(t *testing.T) {
+		repository := newRepository(t)
+		created := createPerson(t, repository, &entities.Person{Name: "John", Surname: "Doe"})
+
+		if err := repository.DeletePerson(created.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		_, err := repository.GetPersonByID(created.ID)
+		expectNotFound(t, "GetPersonByID after delete", err)
+		_, err = repository.GetPersonByName("John")
+		expectNotFound(t, "GetPersonByName after delete", err)
+		_, err = repository.UpdatePerson(&entities.Person{ID: created.ID, Name: "John", Surname: "Doe"})
+		expectNotFound(t, "UpdatePerson after delete", err)
+		expectNotFound(t, "DeletePerson twice", repository.DeletePerson(created.ID))
+		if people, err := repository.GetPeopleByIDs([]int{created.ID}); err != nil || len(people) != 0 {
+			t.Errorf("Expected GetPeopleByIDs to skip the deleted person, got %+v, %v", people, err)
+		}
+
+		deleted, err := repository.GetPersonByIDIncludingDeleted(created.ID)
+		if err != nil || deleted.DeletedAt == nil {
+			t.Fatalf("Expected the deleted person with its deletion time, got %+v, %v", deleted, err)
+		}
+
+		restored, err := repository.RestorePerson(created.ID)
+		if err != nil || restored.DeletedAt != nil {
+			t.Fatalf("Expected the restored person, got %+v, %v", restored, err)
+		}
+		if _, err = repository.RestorePerson(created.ID); !errors.Is(err, apperrors.ErrConflict) {
+			t.Errorf("Expected a conflict restoring a person that is not deleted, got %v", err)
+		}
+		if _, err := repository.GetPersonByID(created.ID); err != nil {
+			t.Errorf("Expected the restored person to be visible, got %v", err)
+		}
+	})
+
+	t.Run("PurgeDeletedPeople", func(t *testing.T) {
+		repository := newRepository(t)
+		deleted := createPerson(t, repository, &entities.Person{Name: "John", Surname: "Doe"})
+		kept := createPerson(t, repository, &entities.Person{Name: "Jane", Surname: "Doe"})
+		if err := repository.DeletePerson(deleted.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if purged, err := repository.PurgeDeletedPeople(time.Now().Add(-time.Hour)); err != nil || len(purged) != 0 {
+			t.Errorf("Expected nothing purged within retention, got %v, %v", purged, err)
+		}
+		purged, err := repository.PurgeDeletedPeople(time.Now().Add(time.Minute))
+		if err != nil || len(purged) != 1 || purged[0] != deleted.ID {
+			t.Errorf("Expected person %d purged, got %v, %v", deleted.ID, purged, err)
+		}
+
+		_, err = repository.GetPersonByIDIncludingDeleted(deleted.ID)
+		expectNotFound(t, "GetPersonByIDIncludingDeleted after purge", err)
+		if _, err := repository.GetPersonByID(kept.ID); err != nil {
+			t.Errorf("Expected the live person to be kept, got %v", err)
+		}
+	})
+
+	t.Run("GetPeopleByIDs", func(t *testing.T) {
+		repository := newRepository(t)
+		john := createPerson(t, repository, &entities.Person{Name: "John", Surname: "Doe"})
+		jane := createPerson(t, repository, &entities.Person{Name: "Jane", Surname: "Doe"})
+
+		people, err := repository.GetPeopleByIDs([]int{jane.ID, 404, john.ID, jane.ID})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		sort.Slice(people, func(i, j int) bool { return people[i].ID < people[j].ID })
+		if len(people) != 2 || people[0].ID != john.ID || people[1].ID != jane.ID {
+			t.Errorf("Expected John and Jane once each, got %+v", people)
+		}
+
+		if people, err := repository.GetPeopleByIDs([]int{}); err != nil || len(people) != 0 {
+			t.Errorf("Expected no people for no IDs, got %+v, %v", people, err)
+		}
+	})
+
+	t.Run("GetDistinctNames", func(t *testing.T) {
+		repository := newRepository(t)
+		if names, err := repository.GetDistinctNames(); err != nil || len(names) != 0 {
+			t.Errorf("Expected no names, got %v, %v", names, err)
+		}
+
+		createPerson(t, repository, &entities.Person{Name: "John", Surname: "Doe"})
+		createPerson(t, repository, &entities.Person{Name: "Jane", Surname: "Doe"})
+		createPerson(t, repository, &entities.Person{Name: "John", Surname: "Smith"})
+		deleted := createPerson(t, repository, &entities.Person{Name: "Ivan", Surname: "Petrov"})
+		if err := repository.DeletePerson(deleted.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		names, err := repository.GetDistinctNames()
+		if err != nil || len(names) != 2 || names[0] != "Jane" || names[1] != "John" {
+			t.Errorf("Expected [Jane John], got %v, %v", names, err)
+		}
+	})
+
+	t.Run("GetPeopleToReEnrich", func(t *testing.T) {
+		repository := newRepository(t)
+		recently, longAgo := enrichedAt, enrichedAt.Add(-60*24*time.Hour)
+		withProvenance := func(name string, provenance entities.Provenance) *entities.Person {
+			return createPerson(t, repository, &entities.Person{Name: name, Surname: "Doe", Provenance: provenance})
+		}
+
+		withProvenance("Manual", entities.Provenance{Age: entities.AttributeProvenance{Source: entities.EnrichmentSourceManual, EnrichedAt: longAgo}})
+		withProvenance("Fresh", entities.Provenance{Age: entities.AttributeProvenance{Source: entities.EnrichmentSourceAPI, EnrichedAt: recently}})
+		withProvenance("Unknown", entities.Provenance{})
+		old := withProvenance("Old", entities.Provenance{
+			Age:    entities.AttributeProvenance{Source: entities.EnrichmentSourceAPI, EnrichedAt: recently},
+			Gender: entities.AttributeProvenance{Source: entities.EnrichmentSourceCache, EnrichedAt: longAgo},
+		})
+		offline := withProvenance("Offline", entities.Provenance{Nationality: entities.AttributeProvenance{Source: entities.EnrichmentSourceOffline, EnrichedAt: recently}})
+		deleted := withProvenance("Deleted", entities.Provenance{Age: entities.AttributeProvenance{Source: entities.EnrichmentSourceOffline, EnrichedAt: recently}})
+		if err := repository.DeletePerson(deleted.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		cutoff := enrichedAt.Add(-30 * 24 * time.Hour)
+		people, err := repository.GetPeopleToReEnrich(cutoff, 0, 10)
+		if err != nil || len(people) != 2 || people[0].ID != old.ID || people[1].ID != offline.ID {
+			t.Fatalf("Expected Old and Offline, got %+v, %v", people, err)
+		}
+		expectSamePerson(t, old, people[0])
+
+		if people, err := repository.GetPeopleToReEnrich(cutoff, 0, 1); err != nil || len(people) != 1 || people[0].ID != old.ID {
+			t.Errorf("Expected only Old with a limit of 1, got %+v, %v", people, err)
+		}
+		if people, err := repository.GetPeopleToReEnrich(cutoff, old.ID, 10); err != nil || len(people) != 1 || people[0].ID != offline.ID {
+			t.Errorf("Expected only Offline after Old, got %+v, %v", people, err)
+		}
+	})
+
+	t.Run("UnicodeNames", func(t *testing.T) {
+		repository := newRepository(t)
+
+		for _, name := range []string{"Дмитрий", "Zoë", "李小龍", "محمد", "José 👋"} {
+			created := createPerson(t, repository, &entities.Person{Name: name, Surname: "Ёлкин", Patronymic: "Иванович"})
+
+			person, err := repository.GetPersonByName(name)
+			if err != nil {
+				t.Fatalf("Expected %q to be found, got %v", name, err)
+			}
+			expectSamePerson(t, created, person)
+		}
+	})
+
+	t.Run("ConcurrentWrites", func(t *testing.T) {
+		repository := newRepository(t)
+
+		const writers = 20
+		ids := make([]int, writers)
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				created, err := repository.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+					return
+				}
+				ids[i] = created.ID
+				if _, err := repository.UpdatePerson(&entities.Person{ID: created.ID, Name: "John", Surname: "Doe", Age: i}); err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		people, err := repository.GetPeopleByIDs(ids)
+		if err != nil || len(people) != writers {
+			t.Fatalf("Expected %d people with distinct IDs, got %d, %v", writers, len(people), err)
+		}
+		for i, id := range ids {
+			person, err := repository.GetPersonByID(id)
+			if err != nil || person.Age != i {
+				t.Errorf("Expected person %d to have age %d, got %+v, %v", id, i, person, err)
+			}
+		}
+	})
+}
+
+func createPerson(t *testing.T, repository repositories.PersonRepository, person *entities.Person) *entities.Person {
+	t.Helper()
+	expected := *person
+
+	created, err := repository.CreatePerson(person)
+	if err != nil {
+		t.Fatalf("Expected no error creating %s, got %v", person.Name, err)
+	}
+	expected.ID = created.ID
+	return &expected
+}
+
+func expectSamePerson(t *testing.T, expected, actual *entities.Person) {
+	t.Helper()
+	if actual.ID != expected.ID || actual.Name != expected.Name || actual.Surname != expected.Surname ||
+		actual.Patronymic != expected.Patronymic || actual.Age != expected.Age ||
+		actual.Gender != expected.Gender || actual.Nationality != expected.Nationality || actual.CountryID != expected.CountryID ||
+		actual.EnrichmentSource != expected.EnrichmentSource || !sameProvenance(expected.Provenance, actual.Provenance) ||
+		actual.EnrichmentStatus != expected.EnrichmentStatus || actual.DeletedAt != nil {
+		t.Errorf("Expected %+v, got %+v", expected, actual)
+	}
+}
+
+func sameProvenance(expected, actual entities.Provenance) bool {
+	for _, attribute := range entities.Attributes {
+		if !expected.Get(attribute).Equal(actual.Get(attribute)) {
+			return false
+		}
+	}
+	return true
+}
+
+func expectNotFound(t *testing.T, operation string, err error) {
+	t.Helper()
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected %s to return a not-found error, got %v", operation, err)
+	}
+}
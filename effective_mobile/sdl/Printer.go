@@ -0,0 +1,284 @@
+package sdl
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+)
+
+var builtInScalars = map[string]bool{"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true}
+
+// Print renders the schema in the GraphQL schema definition language. Types, fields,
+// arguments and enum values are sorted by name so the output is stable and can be diffed.
+func Print(schema graphql.Schema) string {
+	var blocks []string
+	if definition := printSchemaDefinition(schema); definition != "" {
+		blocks = append(blocks, definition)
+	}
+
+	for _, directive := range schema.Directives() {
+		if !isSpecifiedDirective(directive) {
+			blocks = append(blocks, printDirective(directive))
+		}
+	}
+
+	typeMap := schema.TypeMap()
+	names := make([]string, 0, len(typeMap))
+	for name := range typeMap {
+		if strings.HasPrefix(name, "__") || builtInScalars[name] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		blocks = append(blocks, printType(typeMap[name]))
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// printSchemaDefinition returns the schema block, which is only needed when the root
+// types do not use the conventional names.
+func printSchemaDefinition(schema graphql.Schema) string {
+	roots := []struct {
+		operation string
+		rootType  *graphql.Object
+	}{
+		{"query", schema.QueryType()},
+		{"mutation", schema.MutationType()},
+		{"subscription", schema.SubscriptionType()},
+	}
+
+	conventional := true
+	var lines []string
+	for _, root := range roots {
+		if root.rootType == nil {
+			continue
+		}
+		if root.rootType.Name() != strings.ToUpper(root.operation[:1])+root.operation[1:] {
+			conventional = false
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", root.operation, root.rootType.Name()))
+	}
+	if conventional {
+		return ""
+	}
+	return "schema {\n" + strings.Join(lines, "\n") + "\n}"
+}
+
+func printType(t graphql.Type) string {
+	var definition string
+	switch t := t.(type) {
+	case *graphql.Scalar:
+		definition = "scalar " + t.Name()
+	case *graphql.Object:
+		definition = "type " + t.Name()
+		if len(t.Interfaces()) > 0 {
+			interfaces := make([]string, len(t.Interfaces()))
+			for i, iface := range t.Interfaces() {
+				interfaces[i] = iface.Name()
+			}
+			definition += " implements " + strings.Join(interfaces, " & ")
+		}
+		definition += printFields(t.Fields())
+	case *graphql.Interface:
+		definition = "interface " + t.Name() + printFields(t.Fields())
+	case *graphql.Union:
+		members := make([]string, len(t.Types()))
+		for i, member := range t.Types() {
+			members[i] = member.Name()
+		}
+		definition = "union " + t.Name() + " = " + strings.Join(members, " | ")
+	case *graphql.Enum:
+		values := append([]*graphql.EnumValueDefinition(nil), t.Values()...)
+		sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+
+		lines := make([]string, len(values))
+		for i, value := range values {
+			lines[i] = printDescription(value.Description, "  ") + "  " + value.Name + printDeprecated(value.DeprecationReason)
+		}
+		definition = "enum " + t.Name() + printBlock(lines)
+	case *graphql.InputObject:
+		fields := t.Fields()
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		lines := make([]string, len(names))
+		for i, name := range names {
+			field := fields[name]
+			lines[i] = printDescription(field.Description(), "  ") + "  " + name + ": " + field.Type.String() + printDefault(field.DefaultValue, field.Type)
+		}
+		definition = "input " + t.Name() + printBlock(lines)
+	}
+	return printDescription(t.Description(), "") + definition
+}
+
+func printFields(fields graphql.FieldDefinitionMap) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		field := fields[name]
+		lines[i] = printDescription(field.Description, "  ") + "  " + name + printArgs(field.Args, "  ") + ": " + field.Type.String() + printDeprecated(field.DeprecationReason)
+	}
+	return printBlock(lines)
+}
+
+// printArgs renders arguments on one line, or one per line when any of them is described.
+func printArgs(args []*graphql.Argument, indent string) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	args = append([]*graphql.Argument(nil), args...)
+	sort.Slice(args, func(i, j int) bool { return args[i].Name() < args[j].Name() })
+
+	described := false
+	printed := make([]string, len(args))
+	for i, arg := range args {
+		described = described || arg.Description() != ""
+		printed[i] = arg.Name() + ": " + arg.Type.String() + printDefault(arg.DefaultValue, arg.Type)
+	}
+
+	if !described {
+		return "(" + strings.Join(printed, ", ") + ")"
+	}
+
+	lines := make([]string, len(args))
+	for i, arg := range args {
+		lines[i] = printDescription(arg.Description(), indent+"  ") + indent + "  " + printed[i]
+	}
+	return "(\n" + strings.Join(lines, "\n") + "\n" + indent + ")"
+}
+
+func printDirective(directive *graphql.Directive) string {
+	return printDescription(directive.Description, "") + "directive @" + directive.Name + printArgs(directive.Args, "") + " on " + strings.Join(directive.Locations, " | ")
+}
+
+func printBlock(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return " {\n" + strings.Join(lines, "\n") + "\n}"
+}
+
+func printDeprecated(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case graphql.DefaultDeprecationReason:
+		return " @deprecated"
+	default:
+		return " @deprecated(reason: " + quote(reason) + ")"
+	}
+}
+
+// printDescription renders a description on the lines before a definition, as a block
+// string when it spans several lines.
+func printDescription(description, indent string) string {
+	if description == "" {
+		return ""
+	}
+	if !strings.Contains(description, "\n") {
+		return indent + quote(description) + "\n"
+	}
+
+	lines := strings.Split(strings.ReplaceAll(description, `"""`, `\"""`), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return indent + `"""` + "\n" + strings.Join(lines, "\n") + "\n" + indent + `"""` + "\n"
+}
+
+func printDefault(value interface{}, valueType graphql.Input) string {
+	if value == nil {
+		return ""
+	}
+	return " = " + printValue(value, valueType)
+}
+
+// printValue renders a Go default value as a GraphQL literal of the given type.
+func printValue(value interface{}, valueType graphql.Type) string {
+	if value == nil {
+		return "null"
+	}
+	for {
+		nonNull, ok := valueType.(*graphql.NonNull)
+		if !ok {
+			break
+		}
+		valueType = nonNull.OfType
+	}
+
+	switch valueType := valueType.(type) {
+	case *graphql.Enum:
+		for _, enumValue := range valueType.Values() {
+			if reflect.DeepEqual(enumValue.Value, value) {
+				return enumValue.Name
+			}
+		}
+	case *graphql.List:
+		items := reflect.ValueOf(value)
+		if items.Kind() != reflect.Slice {
+			return printValue(value, valueType.OfType)
+		}
+		printed := make([]string, items.Len())
+		for i := range printed {
+			printed[i] = printValue(items.Index(i).Interface(), valueType.OfType)
+		}
+		return "[" + strings.Join(printed, ", ") + "]"
+	case *graphql.InputObject:
+		if fields, ok := value.(map[string]interface{}); ok {
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			printed := make([]string, len(names))
+			for i, name := range names {
+				var fieldType graphql.Type
+				if field, ok := valueType.Fields()[name]; ok {
+					fieldType = field.Type
+				}
+				printed[i] = name + ": " + printValue(fields[name], fieldType)
+			}
+			return "{" + strings.Join(printed, ", ") + "}"
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return quote(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func quote(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+func isSpecifiedDirective(directive *graphql.Directive) bool {
+	for _, specified := range graphql.SpecifiedDirectives {
+		if directive.Name == specified.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/entities"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EnrichmentJobOptions controls how RunEnrichmentJobs runs the asynchronous enrichments.
+type EnrichmentJobOptions struct {
+	// Limit caps how many jobs are taken at once.
+	Limit int
+	// MaxAttempts is how many times an enrichment is tried before being given up.
+	MaxAttempts int
+	// RetryDelay is waited after the first failed attempt, and doubled after each next one.
+	RetryDelay time.Duration
+	// MaxRetryDelay caps the wait between two attempts.
+	MaxRetryDelay time.Duration
+	// Lease is how long a job taken by a worker that stopped waits to be taken again.
+	Lease time.Duration
+}
+
+// DefaultEnrichmentJobOptions tries an enrichment 5 times, waiting from a minute up to an hour.
+var DefaultEnrichmentJobOptions = EnrichmentJobOptions{
+	Limit:         1,
+	MaxAttempts:   5,
+	RetryDelay:    time.Minute,
+	MaxRetryDelay: time.Hour,
+	Lease:         5 * time.Minute,
+}
+
+// EnrichmentProgress reports how the asynchronous enrichment of a person is going.
+type EnrichmentProgress struct {
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// NextAttemptAt is when the enrichment is tried again, nil unless it is pending.
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+// EnrichmentWebhook is posted to the webhook of a person once it is enriched or its
+// enrichment is given up.
+type EnrichmentWebhook struct {
+	Status string           `json:"status"`
+	Person *entities.Person `json:"person"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// CreatePersonAsync stores the person right away as pending and leaves its enrichment
+// to RunEnrichmentJobs, which posts the outcome to webhookURL when one is given.
+func (s *PersonServiceImpl) CreatePersonAsync(person *entities.Person, options EnrichOptions, webhookURL string) (*entities.Person, error) {
+	if s.EnrichmentJobs == nil {
+		return nil, errors.New("asynchronous enrichment is not configured")
+	}
+	if err := ValidatePerson(person); err != nil {
+		return nil, err
+	}
+	if err := enrichment.ValidateProviders(options.SkipProviders); err != nil {
+		return nil, err
+	}
+	if err := s.validateWebhook(webhookURL); err != nil {
+		return nil, err
+	}
+
+	person.EnrichmentSource = ""
+	person.Provenance = entities.Provenance{}
+	person.EnrichmentStatus = entities.EnrichmentStatusPending
+	createdPerson, err := s.CreatePerson(person)
+	if err != nil {
+		// A person stored without its history is taken back like one without its job
+		if createdPerson != nil {
+			s.takeBack(createdPerson.ID)
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &entities.EnrichmentJob{
+		PersonID:      createdPerson.ID,
+		SkipProviders: options.SkipProviders,
+		WebhookURL:    webhookURL,
+		NextAttemptAt: &now,
+	}
+	if err := s.EnrichmentJobs.CreateJob(job); err != nil {
+		// Nothing would ever enrich the person, so it is taken back for the client to retry
+		s.takeBack(createdPerson.ID)
+		return nil, err
+	}
+	return createdPerson, nil
+}
+
+// takeBack deletes a person whose asynchronous creation failed halfway.
+func (s *PersonServiceImpl) takeBack(personID int) {
+	if err := s.DeletePerson(personID); err != nil {
+		fmt.Printf("Error deleting person %d whose asynchronous creation failed: %v\n", personID, err)
+	}
+}
+
+// GetEnrichmentProgress reports the asynchronous enrichment of a person. The status
+// is empty for people enriched before they were stored.
+func (s *PersonServiceImpl) GetEnrichmentProgress(personID int) (EnrichmentProgress, error) {
+	person, err := s.PersonRepository.GetPersonByID(personID)
+	if err != nil {
+		return EnrichmentProgress{}, err
+	}
+
+	progress := EnrichmentProgress{Status: person.EnrichmentStatus}
+	if s.EnrichmentJobs == nil || person.EnrichmentStatus == "" {
+		return progress, nil
+	}
+	job, err := s.EnrichmentJobs.GetJob(personID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return progress, nil
+	}
+	if err != nil {
+		return EnrichmentProgress{}, err
+	}
+	progress.Attempts = job.Attempts
+	progress.LastError = job.LastError
+	if person.EnrichmentStatus == entities.EnrichmentStatusPending {
+		progress.NextAttemptAt = job.NextAttemptAt
+	}
+	return progress, nil
+}
+
+// RunEnrichmentJobs enriches the people whose enrichment is due and returns how many
+// were taken. Provider failures are retried with a growing delay, or once the quota
+// resets without counting as an attempt, until options.MaxAttempts; other failures,
+// such as a name the providers do not know, give the enrichment up at once.
+func (s *PersonServiceImpl) RunEnrichmentJobs(options EnrichmentJobOptions) (int, error) {
+	if s.EnrichmentJobs == nil {
+		return 0, nil
+	}
+
+	jobs, err := s.EnrichmentJobs.ClaimDueJobs(time.Now(), options.Lease, options.Limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, job := range jobs {
+		s.runEnrichmentJob(job, options)
+	}
+	return len(jobs), nil
+}
+
+func (s *PersonServiceImpl) runEnrichmentJob(job *entities.EnrichmentJob, options EnrichmentJobOptions) {
+	person, err := s.enrichPendingPerson(job)
+	var quotaErr *enrichment.QuotaExhaustedError
+	switch {
+	case err == nil:
+		s.deleteEnrichmentJob(job.PersonID)
+		if person != nil {
+			s.notifyWebhook(job.WebhookURL, EnrichmentWebhook{Status: person.EnrichmentStatus, Person: person})
+		}
+	case errors.As(err, &quotaErr):
+		job.LastError = apperrors.Message(err)
+		job.NextAttemptAt = &quotaErr.ResetAt
+		s.updateEnrichmentJob(job)
+	case errors.Is(err, apperrors.ErrUpstream) && job.Attempts+1 < options.MaxAttempts:
+		job.Attempts++
+		job.LastError = apperrors.Message(err)
+		nextAttemptAt := time.Now().Add(retryDelay(job.Attempts, options))
+		job.NextAttemptAt = &nextAttemptAt
+		s.updateEnrichmentJob(job)
+		fmt.Printf("Error enriching person %d, retrying at %s: %v\n", job.PersonID, nextAttemptAt.Format(time.RFC3339), err)
+	default:
+		job.Attempts++
+		job.LastError = apperrors.Message(err)
+		job.NextAttemptAt = nil
+		s.updateEnrichmentJob(job)
+		fmt.Printf("Gave up enriching person %d after %d attempts: %v\n", job.PersonID, job.Attempts, err)
+		if person := s.markEnrichmentFailed(job.PersonID); person != nil {
+			s.notifyWebhook(job.WebhookURL, EnrichmentWebhook{Status: person.EnrichmentStatus, Person: person, Error: job.LastError})
+		}
+	}
+}
+
+// enrichPendingPerson enriches the person of a job and stores it as enriched. The
+// person is nil when it was deleted in the meantime. Attributes edited by hand in the
+// meantime are kept, as in any update.
+func (s *PersonServiceImpl) enrichPendingPerson(job *entities.EnrichmentJob) (*entities.Person, error) {
+	person, err := s.PersonRepository.GetPersonByID(job.PersonID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	enriched := *person
+	if err := s.Enricher.Enrich(&enriched, job.SkipProviders); err != nil {
+		return nil, err
+	}
+	enriched.EnrichmentStatus = entities.EnrichmentStatusEnriched
+	updatedPerson, err := s.UpdatePerson(&enriched)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil && updatedPerson != nil {
+		// The person is enriched, only its history is missing
+		fmt.Printf("Error updating enriched person %d: %v\n", job.PersonID, err)
+		return updatedPerson, nil
+	}
+	return updatedPerson, err
+}
+
+// markEnrichmentFailed stores that the enrichment of a person was given up, and
+// returns the person or nil when it cannot be updated.
+func (s *PersonServiceImpl) markEnrichmentFailed(personID int) *entities.Person {
+	person, err := s.PersonRepository.GetPersonByID(personID)
+	if err == nil {
+		person.EnrichmentStatus = entities.EnrichmentStatusFailed
+		person, err = s.UpdatePerson(person)
+	}
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		fmt.Printf("Error marking the enrichment of person %d as failed: %v\n", personID, err)
+	}
+	// The person is marked even when only its history is missing
+	return person
+}
+
+func (s *PersonServiceImpl) updateEnrichmentJob(job *entities.EnrichmentJob) {
+	if err := s.EnrichmentJobs.UpdateJob(job); err != nil {
+		// The job is taken again once its lease ends
+		fmt.Printf("Error updating the enrichment job of person %d: %v\n", job.PersonID, err)
+	}
+}
+
+func (s *PersonServiceImpl) deleteEnrichmentJob(personID int) {
+	if err := s.EnrichmentJobs.DeleteJob(personID); err != nil {
+		fmt.Printf("Error deleting the enrichment job of person %d: %v\n", personID, err)
+	}
+}
+
+// retryDelay returns the wait after the given number of failed attempts.
+func retryDelay(attempts int, options EnrichmentJobOptions) time.Duration {
+	delay := options.RetryDelay
+	for i := 1; i < attempts && delay < options.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > options.MaxRetryDelay {
+		delay = options.MaxRetryDelay
+	}
+	return delay
+}
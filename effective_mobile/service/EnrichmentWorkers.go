@@ -0,0 +1,78 @@
+package service
+
+import (
+	"effective_mobile/entities"
+	"effective_mobile/events"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StartEnrichmentWorkers runs the asynchronous enrichments with the given number of
+// workers. Idle workers look for due jobs every interval, which must be positive, and
+// right away when a pending person is created. The returned function stops the
+// workers, letting them finish the jobs they took.
+func StartEnrichmentWorkers(personService PersonService, workers int, interval time.Duration, options EnrichmentJobOptions) func() {
+	done := make(chan struct{})
+	wake := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	personEvents, unsubscribe := personService.SubscribeEvents(100)
+	go func() {
+		for {
+			select {
+			case event, ok := <-personEvents:
+				if !ok {
+					return
+				}
+				if event.Type != events.PersonCreated || event.Person.EnrichmentStatus != entities.EnrichmentStatusPending {
+					continue
+				}
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				taken, err := personService.RunEnrichmentJobs(options)
+				if err != nil {
+					fmt.Printf("Error running enrichment jobs: %v\n", err)
+				}
+				// Keep going while there is more work
+				if err == nil && taken == options.Limit {
+					select {
+					case <-done:
+						return
+					default:
+						continue
+					}
+				}
+
+				select {
+				case <-ticker.C:
+				case <-wake:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	return func() {
+		close(done)
+		unsubscribe()
+		wg.Wait()
+	}
+}
@@ -1,39 +1,30 @@
 package service
 
 import (
-	"database/sql"
 	"effective_mobile/entities"
-	"effective_mobile/repositories"
-	"effective_mobile/repositories/impl"
+	"effective_mobile/events"
+	"time"
 )
 
-type PersonService struct {
-	PersonRepository repositories.PersonRepository
-}
-
-func NewPersonService(db *sql.DB) *PersonService {
-	personRepository := impl.NewPersonRepository(db)
-	return &PersonService{
-		PersonRepository: personRepository,
-	}
-}
-
-func (s *PersonService) CreatePerson(person *entities.Person) (*entities.Person, error) {
-	return s.PersonRepository.CreatePerson(person)
-}
-
-func (s *PersonService) GetPersonByID(personID int) (*entities.Person, error) {
-	return s.PersonRepository.GetPersonByID(personID)
-}
-
-func (s *PersonService) GetPersonByName(name string) (*entities.Person, error) {
-	return s.PersonRepository.GetPersonByName(name)
-}
-
-func (s *PersonService) UpdatePerson(person *entities.Person) (*entities.Person, error) {
-	return s.PersonRepository.UpdatePerson(person)
-}
-
-func (s *PersonService) DeletePerson(personId int) bool {
-	return s.PersonRepository.DeletePerson(personId)
+// PersonService is the use-case layer shared by the REST, GraphQL and Kafka entry points.
+type PersonService interface {
+	CreatePerson(person *entities.Person) (*entities.Person, error)
+	CreatePersonWithEnrichment(person *entities.Person, options EnrichOptions) (*entities.Person, error)
+	CreatePersonAsync(person *entities.Person, options EnrichOptions, webhookURL string) (*entities.Person, error)
+	GetEnrichmentProgress(personID int) (EnrichmentProgress, error)
+	GetPersonByID(personID int) (*entities.Person, error)
+	GetPersonByIDIncludingDeleted(personID int) (*entities.Person, error)
+	GetPeopleByIDs(personIDs []int) ([]*entities.Person, error)
+	GetDistinctNames() ([]string, error)
+	GetPersonByName(name string) (*entities.Person, error)
+	UpdatePerson(person *entities.Person) (*entities.Person, error)
+	DeletePerson(personID int) error
+	RestorePerson(personID int) (*entities.Person, error)
+	PurgeDeletedPeople(retention time.Duration) (int, error)
+	ReEnrichPeople(options ReEnrichOptions) (ReEnrichResult, error)
+	RunEnrichmentJobs(options EnrichmentJobOptions) (int, error)
+	GetPersonHistory(personID int) ([]entities.PersonHistory, error)
+	// WithOrigin returns a service that records changes as made by the given actor and channel.
+	WithOrigin(origin entities.ChangeOrigin) PersonService
+	SubscribeEvents(buffer int) (<-chan events.PersonEvent, func())
 }
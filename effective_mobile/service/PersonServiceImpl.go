@@ -0,0 +1,470 @@
+package service
+
+import (
+	"database/sql"
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/entities"
+	"effective_mobile/events"
+	"effective_mobile/repositories"
+	"effective_mobile/repositories/impl"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PersonServiceImpl struct {
+	PersonRepository  repositories.PersonRepository
+	HistoryRepository repositories.PersonHistoryRepository
+	Enricher          enrichment.Enricher
+	// ReEnricher enriches people again in ReEnrichPeople; without one, Enricher is used.
+	ReEnricher enrichment.ReEnricher
+	// EnrichmentJobs stores the enrichments of the people created by CreatePersonAsync,
+	// which is unavailable without it.
+	EnrichmentJobs repositories.EnrichmentJobRepository
+	// Webhooks posts the outcome of the asynchronous enrichments; without it, no
+	// webhook is accepted.
+	Webhooks *WebhookSender
+	Events   *events.Bus
+	Origin   entities.ChangeOrigin
+}
+
+// EnrichOptions controls how a person is enriched before being created.
+type EnrichOptions struct {
+	// Enrich turns enrichment on; when off the person is stored with the values it has.
+	Enrich bool
+	// SkipProviders lists providers whose attribute the caller supplies itself.
+	SkipProviders []string
+}
+
+// DefaultEnrichOptions enriches every attribute.
+var DefaultEnrichOptions = EnrichOptions{Enrich: true}
+
+// ReEnrichOptions controls which people ReEnrichPeople enriches again.
+type ReEnrichOptions struct {
+	// MaxAge is how old provider results may get before they are fetched again.
+	MaxAge time.Duration
+	// Limit caps how many people are checked in one run.
+	Limit int
+	// AfterID resumes where a previous run stopped.
+	AfterID int
+	// Delay is waited between two people, to stay under the provider rate limits.
+	Delay time.Duration
+}
+
+// DefaultReEnrichOptions re-enriches attributes older than 30 days, 100 people at a time.
+var DefaultReEnrichOptions = ReEnrichOptions{MaxAge: 30 * 24 * time.Hour, Limit: 100, Delay: time.Second}
+
+// ReEnrichResult reports the outcome of ReEnrichPeople.
+type ReEnrichResult struct {
+	Checked int `json:"checked"`
+	Updated int `json:"updated"`
+	// LastID is the ID of the last person checked, to pass as AfterID to the next run.
+	LastID int `json:"lastId"`
+}
+
+// reEnrichPageSize is how many people ReEnrichPeople loads at once.
+const reEnrichPageSize = 100
+
+func NewPersonService(db *sql.DB, enricher enrichment.Enricher) *PersonServiceImpl {
+	personRepository := impl.NewPersonRepository(db)
+	historyRepository := impl.NewPersonHistoryRepository(db)
+	personService := NewPersonServiceWithRepositories(personRepository, historyRepository, enricher)
+	personService.EnrichmentJobs = impl.NewEnrichmentJobRepository(db)
+	return personService
+}
+
+// NewPersonServiceWithRepositories builds the service on any storage, e.g. the in-memory
+// repositories of the memory package.
+func NewPersonServiceWithRepositories(personRepository repositories.PersonRepository, historyRepository repositories.PersonHistoryRepository, enricher enrichment.Enricher) *PersonServiceImpl {
+	return &PersonServiceImpl{
+		PersonRepository:  personRepository,
+		HistoryRepository: historyRepository,
+		Enricher:          enricher,
+		Webhooks:          NewWebhookSender(WebhookConfig{}),
+		Events:            events.NewBus(),
+	}
+}
+
+// WithOrigin returns a copy of the service that records changes as made by the given actor and channel.
+func (s *PersonServiceImpl) WithOrigin(origin entities.ChangeOrigin) PersonService {
+	scoped := *s
+	scoped.Origin = origin
+	return &scoped
+}
+
+// CreatePerson validates and stores the person. When it is stored but its history
+// cannot be recorded, the person is returned along with the error, as the other
+// mutations do.
+func (s *PersonServiceImpl) CreatePerson(person *entities.Person) (*entities.Person, error) {
+	if err := ValidatePerson(person); err != nil {
+		return nil, err
+	}
+
+	trackProvenance(person, nil)
+	createdPerson, err := s.PersonRepository.CreatePerson(person)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.recordChange(entities.ActionCreate, createdPerson.ID, nil, createdPerson)
+	s.publish(events.PersonCreated, createdPerson)
+	return createdPerson, err
+}
+
+// CreatePersonWithEnrichment validates the person, enriches it as requested and creates it.
+// It is the create pipeline shared by the REST, GraphQL and Kafka entry points.
+func (s *PersonServiceImpl) CreatePersonWithEnrichment(person *entities.Person, options EnrichOptions) (*entities.Person, error) {
+	if err := ValidatePerson(person); err != nil {
+		return nil, err
+	}
+
+	// Only the enricher says where the attributes came from, and only an asynchronous
+	// creation leaves them pending
+	person.EnrichmentSource = ""
+	person.Provenance = entities.Provenance{}
+	person.EnrichmentStatus = ""
+	if options.Enrich {
+		if err := enrichment.ValidateProviders(options.SkipProviders); err != nil {
+			return nil, err
+		}
+		if err := s.Enricher.Enrich(person, options.SkipProviders); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.CreatePerson(person)
+}
+
+func (s *PersonServiceImpl) GetPersonByID(personID int) (*entities.Person, error) {
+	return s.PersonRepository.GetPersonByID(personID)
+}
+
+func (s *PersonServiceImpl) GetPersonByIDIncludingDeleted(personID int) (*entities.Person, error) {
+	return s.PersonRepository.GetPersonByIDIncludingDeleted(personID)
+}
+
+func (s *PersonServiceImpl) GetDistinctNames() ([]string, error) {
+	return s.PersonRepository.GetDistinctNames()
+}
+
+func (s *PersonServiceImpl) GetPeopleByIDs(personIDs []int) ([]*entities.Person, error) {
+	return s.PersonRepository.GetPeopleByIDs(personIDs)
+}
+
+func (s *PersonServiceImpl) GetPersonByName(name string) (*entities.Person, error) {
+	return s.PersonRepository.GetPersonByName(name)
+}
+
+func (s *PersonServiceImpl) UpdatePerson(person *entities.Person) (*entities.Person, error) {
+	if err := ValidatePerson(person); err != nil {
+		return nil, err
+	}
+
+	before, err := s.PersonRepository.GetPersonByID(person.ID)
+	if err != nil {
+		return nil, err
+	}
+	trackProvenance(person, before)
+	if person.EnrichmentStatus == "" {
+		person.EnrichmentStatus = before.EnrichmentStatus
+	}
+
+	updatedPerson, err := s.PersonRepository.UpdatePerson(person)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.recordChange(entities.ActionUpdate, updatedPerson.ID, before, updatedPerson)
+	s.publish(events.PersonUpdated, updatedPerson)
+	return updatedPerson, err
+}
+
+func (s *PersonServiceImpl) DeletePerson(personId int) error {
+	before := s.snapshot(personId, s.PersonRepository.GetPersonByID)
+
+	if err := s.PersonRepository.DeletePerson(personId); err != nil {
+		return err
+	}
+
+	err := s.recordChange(entities.ActionDelete, personId, before, nil)
+	if before == nil {
+		before = &entities.Person{ID: personId}
+	}
+	s.publish(events.PersonDeleted, before)
+	return err
+}
+
+func (s *PersonServiceImpl) RestorePerson(personID int) (*entities.Person, error) {
+	before := s.snapshot(personID, s.PersonRepository.GetPersonByIDIncludingDeleted)
+
+	restoredPerson, err := s.PersonRepository.RestorePerson(personID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.recordChange(entities.ActionRestore, personID, before, restoredPerson)
+	s.publish(events.PersonUpdated, restoredPerson)
+	return restoredPerson, err
+}
+
+// PurgeDeletedPeople permanently removes people that were soft-deleted longer than retention ago.
+func (s *PersonServiceImpl) PurgeDeletedPeople(retention time.Duration) (int, error) {
+	purgedIDs, err := s.PersonRepository.PurgeDeletedPeople(time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, personID := range purgedIDs {
+		if historyErr := s.recordChange(entities.ActionPurge, personID, nil, nil); historyErr != nil && err == nil {
+			err = historyErr
+		}
+	}
+	return len(purgedIDs), err
+}
+
+// ReEnrichPeople enriches again the attributes from the offline statistics and those
+// fetched from the providers longer than options.MaxAge ago. Attributes entered by hand
+// are left alone, and so are people the providers do not know. It stops at the first
+// provider failure, e.g. when the rate limit is hit, and the next run can resume from
+// the returned LastID.
+func (s *PersonServiceImpl) ReEnrichPeople(options ReEnrichOptions) (ReEnrichResult, error) {
+	result := ReEnrichResult{LastID: options.AfterID}
+	enrichedBefore := time.Now().Add(-options.MaxAge)
+
+	for result.Checked < options.Limit {
+		pageSize := reEnrichPageSize
+		if remaining := options.Limit - result.Checked; remaining < pageSize {
+			pageSize = remaining
+		}
+		people, err := s.PersonRepository.GetPeopleToReEnrich(enrichedBefore, result.LastID, pageSize)
+		if err != nil {
+			return result, err
+		}
+
+		for _, person := range people {
+			if result.Checked > 0 && options.Delay > 0 {
+				time.Sleep(options.Delay)
+			}
+			updated, err := s.reEnrichPerson(person, enrichedBefore)
+			if err != nil {
+				return result, err
+			}
+			result.Checked++
+			result.LastID = person.ID
+			if updated {
+				result.Updated++
+			}
+		}
+
+		if len(people) < pageSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+// reEnrichPerson enriches the stale attributes of a person again and reports whether
+// the person was updated.
+func (s *PersonServiceImpl) reEnrichPerson(person *entities.Person, enrichedBefore time.Time) (bool, error) {
+	stale := person.Provenance.StaleAttributes(enrichedBefore)
+	var skipProviders []string
+	for _, attribute := range entities.Attributes {
+		if !containsString(stale, attribute) {
+			skipProviders = append(skipProviders, enrichment.AttributeProviders[attribute])
+		}
+	}
+
+	enriched := *person
+	var err error
+	if s.ReEnricher != nil {
+		err = s.ReEnricher.ReEnrich(&enriched, skipProviders, enrichedBefore)
+	} else {
+		err = s.Enricher.Enrich(&enriched, skipProviders)
+	}
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := s.UpdatePerson(&enriched); err != nil {
+		// Deleted in the meantime
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *PersonServiceImpl) GetPersonHistory(personID int) ([]entities.PersonHistory, error) {
+	if s.HistoryRepository == nil {
+		return []entities.PersonHistory{}, nil
+	}
+	return s.HistoryRepository.GetHistory(personID)
+}
+
+// snapshot loads the current state of a person for the history record and events.
+// It is skipped when neither is in use, so the repository is not queried needlessly.
+func (s *PersonServiceImpl) snapshot(personID int, load func(int) (*entities.Person, error)) *entities.Person {
+	if s.HistoryRepository == nil && s.Events == nil {
+		return nil
+	}
+
+	person, err := load(personID)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return nil
+		}
+		fmt.Printf("Error loading person %d for history: %v\n", personID, err)
+		return nil
+	}
+	return person
+}
+
+// recordChange records a change in the history of the person. The change is already
+// saved when it fails.
+func (s *PersonServiceImpl) recordChange(action string, personID int, before, after *entities.Person) error {
+	if s.HistoryRepository == nil {
+		return nil
+	}
+
+	actor := s.Origin.Actor
+	if actor == "" {
+		actor = "anonymous"
+	}
+
+	entry := &entities.PersonHistory{
+		PersonID:  personID,
+		Action:    action,
+		Before:    copyPerson(before),
+		After:     copyPerson(after),
+		Actor:     actor,
+		Source:    s.Origin.Source,
+		ChangedAt: time.Now().UTC(),
+	}
+	if err := s.HistoryRepository.RecordChange(entry); err != nil {
+		fmt.Printf("Error recording %s of person %d in history: %v\n", action, personID, err)
+		// Not an upstream failure, as retrying would make the change again
+		return fmt.Errorf("the %s of person %d was saved but its history could not be recorded: %w", action, personID, err)
+	}
+	return nil
+}
+
+// SubscribeEvents subscribes to the changes made through the service. Without an event
+// bus no event is ever delivered.
+func (s *PersonServiceImpl) SubscribeEvents(buffer int) (<-chan events.PersonEvent, func()) {
+	if s.Events == nil {
+		return nil, func() {}
+	}
+	return s.Events.Subscribe(buffer)
+}
+
+// publish notifies subscribers of a successful write.
+func (s *PersonServiceImpl) publish(eventType string, person *entities.Person) {
+	if s.Events == nil {
+		return
+	}
+	s.Events.Publish(events.PersonEvent{Type: eventType, Person: copyPerson(person)})
+}
+
+// trackProvenance completes the provenance of a person about to be stored over stored,
+// which is nil for a new person. Attributes changed without a provenance of their own
+// were entered by hand, and enriched values never overwrite attributes entered by hand,
+// e.g. when a person is edited while being enriched again.
+func trackProvenance(person, stored *entities.Person) {
+	now := time.Now().UTC()
+	for _, attribute := range entities.Attributes {
+		given := person.Provenance.Get(attribute)
+		var current entities.AttributeProvenance
+		changed := attributeValue(person, attribute) != attributeValue(&entities.Person{}, attribute)
+		if stored != nil {
+			current = stored.Provenance.Get(attribute)
+			changed = attributeValue(person, attribute) != attributeValue(stored, attribute)
+		}
+
+		switch {
+		case given.Equal(current) || given == (entities.AttributeProvenance{}):
+			if changed {
+				current = entities.AttributeProvenance{Source: entities.EnrichmentSourceManual, EnrichedAt: now}
+			}
+			person.Provenance.Set(attribute, current)
+		case current.Source == entities.EnrichmentSourceManual:
+			copyAttribute(person, stored, attribute)
+			person.Provenance.Set(attribute, current)
+		}
+	}
+
+	switch {
+	case !person.Provenance.IsZero():
+		person.EnrichmentSource = person.Provenance.Summary()
+	case stored != nil:
+		// Stored before provenance was recorded, and its attributes are unchanged
+		person.EnrichmentSource = stored.EnrichmentSource
+	}
+}
+
+func attributeValue(person *entities.Person, attribute string) string {
+	switch attribute {
+	case entities.AttributeAge:
+		return strconv.Itoa(person.Age)
+	case entities.AttributeGender:
+		return person.Gender
+	default:
+		return person.Nationality
+	}
+}
+
+func copyAttribute(to, from *entities.Person, attribute string) {
+	switch attribute {
+	case entities.AttributeAge:
+		to.Age = from.Age
+	case entities.AttributeGender:
+		to.Gender = from.Gender
+	default:
+		to.Nationality = from.Nationality
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePerson checks the fields every person must have, and normalizes the
+// country hint.
+func ValidatePerson(person *entities.Person) error {
+	fields := map[string]string{}
+	if strings.TrimSpace(person.Name) == "" {
+		fields["name"] = "Name is required"
+	}
+	if strings.TrimSpace(person.Surname) == "" {
+		fields["surname"] = "Surname is required"
+	}
+	person.CountryID = enrichment.NormalizeCountryID(person.CountryID)
+	if !enrichment.ValidCountryID(person.CountryID) {
+		fields["countryId"] = "Country ID must be a two-letter ISO 3166-1 code"
+	}
+
+	if len(fields) > 0 {
+		return apperrors.InvalidFields(fields)
+	}
+	return nil
+}
+
+// copyPerson detaches a snapshot from the caller's pointer, which may be modified after the change.
+func copyPerson(person *entities.Person) *entities.Person {
+	if person == nil {
+		return nil
+	}
+	snapshot := *person
+	return &snapshot
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// StartPurgeJob purges people soft-deleted longer than retention ago every interval,
+// which must be positive. The returned function stops the job.
+func StartPurgeJob(personService PersonService, interval, retention time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				purged, err := personService.PurgeDeletedPeople(retention)
+				if err != nil {
+					fmt.Printf("Error purging deleted people: %v\n", err)
+					continue
+				}
+				if purged > 0 {
+					fmt.Printf("Purged %d deleted people\n", purged)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
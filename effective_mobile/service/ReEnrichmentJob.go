@@ -0,0 +1,39 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// StartReEnrichmentJob periodically enriches again the people whose attributes came
+// from the offline statistics or are older than options.MaxAge, options.Limit people
+// per run. Each run resumes where the previous one stopped, so people the providers
+// do not know cannot hold the others back. The returned function stops the job.
+func StartReEnrichmentJob(personService PersonService, interval time.Duration, options ReEnrichOptions) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				result, err := personService.ReEnrichPeople(options)
+				if err != nil {
+					fmt.Printf("Error re-enriching people after person %d: %v\n", result.LastID, err)
+				} else if result.Updated > 0 {
+					fmt.Printf("Re-enriched %d of %d people\n", result.Updated, result.Checked)
+				}
+				// Start over once every stale person was checked
+				options.AfterID = result.LastID
+				if err == nil && result.Checked < options.Limit {
+					options.AfterID = 0
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
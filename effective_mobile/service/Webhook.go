@@ -0,0 +1,166 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"effective_mobile/apperrors"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WebhookConfig restricts where webhooks are posted, since their URLs come from clients.
+type WebhookConfig struct {
+	// AllowedHosts lists the only hosts webhooks may be posted to; when empty, any
+	// host resolving to public addresses is allowed.
+	AllowedHosts []string
+	// AllowPrivate lets webhooks reach loopback, private and link-local addresses,
+	// e.g. a receiver on the same machine during development.
+	AllowPrivate bool
+}
+
+// webhookAttempts is how many times a webhook is posted before it is given up.
+const webhookAttempts = 3
+
+// sharedAddressSpace is the carrier-grade NAT range, often used inside clusters.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// WebhookSender posts webhooks to the URLs clients give. Unless AllowPrivate is set,
+// it only connects to public addresses, checked again when connecting so that a host
+// cannot resolve to an internal address after it was validated, and it does not
+// follow redirects.
+type WebhookSender struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+func NewWebhookSender(config WebhookConfig) *WebhookSender {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !config.AllowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("webhook address %s is not public", address)
+			}
+			return nil
+		}
+	}
+
+	return &WebhookSender{
+		config: config,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// No proxy, so that the address check applies to the receiver itself
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Validate accepts an empty URL or an absolute http or https one to an allowed host
+// resolving to public addresses only.
+func (w *WebhookSender) Validate(ctx context.Context, webhookURL string) error {
+	if webhookURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return invalidWebhook("webhook must be an absolute http or https URL")
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if len(w.config.AllowedHosts) > 0 && !containsFold(w.config.AllowedHosts, host) {
+		return invalidWebhook("webhook host " + host + " is not allowed")
+	}
+	if w.config.AllowPrivate {
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addresses) == 0 {
+		return invalidWebhook("webhook host " + host + " cannot be resolved")
+	}
+	for _, address := range addresses {
+		if !isPublicIP(address.IP) {
+			return invalidWebhook("webhook must not point to a private address")
+		}
+	}
+	return nil
+}
+
+// Send posts payload to webhookURL, trying again a few times when the receiver
+// fails, and returns the last error.
+func (w *WebhookSender) Send(webhookURL string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+		var resp *http.Response
+		resp, err = w.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < http.StatusMultipleChoices {
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		fmt.Printf("Error posting webhook to %s (attempt %d of %d): %v\n", webhookURL, attempt, webhookAttempts, err)
+	}
+	return err
+}
+
+// validateWebhook checks a webhook URL given to CreatePersonAsync.
+func (s *PersonServiceImpl) validateWebhook(webhookURL string) error {
+	if webhookURL == "" {
+		return nil
+	}
+	if s.Webhooks == nil {
+		return invalidWebhook("webhooks are not enabled")
+	}
+	return s.Webhooks.Validate(context.Background(), webhookURL)
+}
+
+// notifyWebhook posts payload to webhookURL. Nothing is posted without a webhook.
+func (s *PersonServiceImpl) notifyWebhook(webhookURL string, payload EnrichmentWebhook) {
+	if webhookURL == "" || s.Webhooks == nil {
+		return
+	}
+	if err := s.Webhooks.Send(webhookURL, payload); err != nil {
+		fmt.Printf("Gave up posting the webhook of person %d: %v\n", payload.Person.ID, err)
+	}
+}
+
+// isPublicIP reports whether ip can be reached on the internet, as opposed to the
+// loopback, private, link-local and shared addresses of the hosts around the service.
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+func invalidWebhook(message string) error {
+	return apperrors.InvalidFields(map[string]string{"webhook": message})
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+func TestErrorMapping(t *testing.T) {
+	cases := []struct {
+		err         error
+		status      int
+		graphQLCode string
+		dlqClass    string
+	}{
+		{apperrors.NotFound("Person not found"), http.StatusNotFound, "NOT_FOUND", "not_found"},
+		{apperrors.Conflict(errors.New("duplicate key"), "Person already exists"), http.StatusConflict, "CONFLICT", "conflict"},
+		{apperrors.Validation("Name is required"), http.StatusBadRequest, "BAD_USER_INPUT", "validation"},
+		{apperrors.Upstream(errors.New("connection refused"), "Error fetching person"), http.StatusServiceUnavailable, "UPSTREAM_FAILURE", "upstream"},
+		{errors.New("boom"), http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "internal"},
+	}
+
+	for _, c := range cases {
+		if status := apperrors.HTTPStatus(c.err); status != c.status {
+			t.Errorf("Expected status %d for %v, got %d", c.status, c.err, status)
+		}
+		if code := apperrors.GraphQLCode(c.err); code != c.graphQLCode {
+			t.Errorf("Expected GraphQL code %s for %v, got %s", c.graphQLCode, c.err, code)
+		}
+		if class := apperrors.DLQClass(c.err); class != c.dlqClass {
+			t.Errorf("Expected DLQ class %s for %v, got %s", c.dlqClass, c.err, class)
+		}
+	}
+}
+
+func TestUpstreamErrorHidesCause(t *testing.T) {
+	cause := errors.New("dial tcp 10.0.0.1:5432: connection refused")
+	err := apperrors.Upstream(cause, "Error fetching person")
+
+	if !errors.Is(err, cause) {
+		t.Errorf("Expected the cause to stay reachable with errors.Is")
+	}
+	if message := apperrors.Message(err); message != "Error fetching person" {
+		t.Errorf("Expected client message without the cause, got '%s'", message)
+	}
+}
+
+func TestGraphQLErrorExtensions(t *testing.T) {
+	err := apperrors.GraphQLError(apperrors.NotFound("Person not found"))
+
+	extended, ok := err.(gqlerrors.ExtendedError)
+	if !ok {
+		t.Fatalf("Expected a GraphQL extended error, got %T", err)
+	}
+	if code := extended.Extensions()["code"]; code != "NOT_FOUND" {
+		t.Errorf("Expected code NOT_FOUND, got %v", code)
+	}
+	if apperrors.GraphQLError(nil) != nil {
+		t.Errorf("Expected nil error to stay nil")
+	}
+}
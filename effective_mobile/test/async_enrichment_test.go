@@ -0,0 +1,237 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newAsyncService builds a service on db, or on the in-memory repositories when it is
+// nil, enriching from the provider stub in the background.
+func newAsyncService(t *testing.T, db *sql.DB, stubConfig enrichstub.Config) *service.PersonServiceImpl {
+	t.Helper()
+
+	var personService *service.PersonServiceImpl
+	if db != nil {
+		personService = service.NewPersonService(db, newStubEnricher(t, stubConfig))
+	} else {
+		personService = service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), newStubEnricher(t, stubConfig))
+		personService.EnrichmentJobs = memory.NewEnrichmentJobRepository()
+	}
+	// The webhook receivers of the tests listen on the loopback
+	personService.Webhooks = service.NewWebhookSender(service.WebhookConfig{AllowPrivate: true})
+	return personService
+}
+
+func TestAsyncEnrichment_Memory(t *testing.T) {
+	runAsyncEnrichment(t, func(t *testing.T) *sql.DB { return nil })
+}
+
+func TestAsyncEnrichment_Postgres(t *testing.T) {
+	db := openTestDatabase(t)
+
+	runAsyncEnrichment(t, func(t *testing.T) *sql.DB {
+		if _, err := db.Exec("TRUNCATE persons, person_history, enrichment_jobs RESTART IDENTITY"); err != nil {
+			t.Fatalf("Failed to empty tables: %v", err)
+		}
+		return db
+	})
+}
+
+func runAsyncEnrichment(t *testing.T, openDB func(t *testing.T) *sql.DB) {
+	t.Run("Endpoint", func(t *testing.T) {
+		testAsyncEnrichmentEndpoint(t, openDB(t))
+	})
+	t.Run("RetriesFailures", func(t *testing.T) {
+		testAsyncEnrichmentRetriesFailures(t, openDB(t))
+	})
+}
+
+// testAsyncEnrichmentEndpoint creates a person without skipProviders, which leaves the
+// skipped providers of its job nil.
+func testAsyncEnrichmentEndpoint(t *testing.T, db *sql.DB) {
+	personService := newAsyncService(t, db, enrichstub.Config{})
+	router := newTestRouter(t, personService)
+
+	webhooks := make(chan service.EnrichmentWebhook, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var webhook service.EnrichmentWebhook
+		if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+			t.Errorf("Expected a JSON webhook, got %v", err)
+		}
+		webhooks <- webhook
+	}))
+	defer receiver.Close()
+
+	body := `{"Name": "Dmitriy", "Surname": "Ushakov"}`
+	if recorder := serve(router, http.MethodPost, "/api/people?async=true&webhook=ftp://example.com", body, nil); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an ftp webhook, got %d", recorder.Code)
+	}
+
+	recorder := serve(router, http.MethodPost, "/api/people?async=true&webhook="+receiver.URL, body, nil)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var created entities.Person
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Expected a person, got %s", recorder.Body.String())
+	}
+	if location := recorder.Header().Get("Location"); location != fmt.Sprintf("/api/people/%d", created.ID) {
+		t.Errorf("Expected the location of person %d, got %q", created.ID, location)
+	}
+	if created.EnrichmentStatus != entities.EnrichmentStatusPending || created.Age != 0 {
+		t.Errorf("Expected a pending person without age, got %+v", created)
+	}
+
+	stop := service.StartEnrichmentWorkers(personService, 2, time.Hour, service.DefaultEnrichmentJobOptions)
+	defer stop()
+
+	select {
+	case webhook := <-webhooks:
+		if webhook.Status != entities.EnrichmentStatusEnriched || webhook.Person.ID != created.ID || webhook.Person.Age != 43 {
+			t.Errorf("Expected person %d enriched with age 43, got %+v", created.ID, webhook)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the webhook")
+	}
+
+	recorder = serve(router, http.MethodGet, fmt.Sprintf("/api/people/%d/enrichment", created.ID), "", nil)
+	var progress service.EnrichmentProgress
+	if err := json.Unmarshal(recorder.Body.Bytes(), &progress); err != nil || progress.Status != entities.EnrichmentStatusEnriched {
+		t.Errorf("Expected the enrichment to be done, got %s", recorder.Body.String())
+	}
+	person, _ := personService.GetPersonByID(created.ID)
+	if person.Nationality != "UA" || person.EnrichmentSource != entities.EnrichmentSourceAPI {
+		t.Errorf("Expected UA from the providers, got %+v", person)
+	}
+}
+
+func testAsyncEnrichmentRetriesFailures(t *testing.T, db *sql.DB) {
+	personService := newAsyncService(t, db, enrichstub.Config{ErrorRate: 1})
+	options := service.EnrichmentJobOptions{Limit: 10, MaxAttempts: 2, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond, Lease: time.Minute}
+
+	created, err := personService.CreatePersonAsync(&entities.Person{Name: "Dmitriy", Surname: "Ushakov"}, service.DefaultEnrichOptions, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if taken, err := personService.RunEnrichmentJobs(options); err != nil || taken != 1 {
+		t.Fatalf("Expected one job, got %d, %v", taken, err)
+	}
+	progress, _ := personService.GetEnrichmentProgress(created.ID)
+	if progress.Status != entities.EnrichmentStatusPending || progress.Attempts != 1 || progress.NextAttemptAt == nil || progress.LastError == "" {
+		t.Errorf("Expected the enrichment to be retried, got %+v", progress)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if taken, err := personService.RunEnrichmentJobs(options); err != nil || taken != 1 {
+		t.Fatalf("Expected the job to be retried, got %d, %v", taken, err)
+	}
+	progress, _ = personService.GetEnrichmentProgress(created.ID)
+	if progress.Status != entities.EnrichmentStatusFailed || progress.Attempts != 2 || progress.NextAttemptAt != nil {
+		t.Errorf("Expected the enrichment to be given up after 2 attempts, got %+v", progress)
+	}
+	if person, _ := personService.GetPersonByID(created.ID); person.EnrichmentStatus != entities.EnrichmentStatusFailed {
+		t.Errorf("Expected the person to be kept as failed, got %+v", person)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if taken, _ := personService.RunEnrichmentJobs(options); taken != 0 {
+		t.Errorf("Expected no job after giving up, got %d", taken)
+	}
+}
+
+// unavailableJobRepository fails to queue any job, like a database going away.
+type unavailableJobRepository struct {
+	*memory.EnrichmentJobRepository
+}
+
+func (r unavailableJobRepository) CreateJob(job *entities.EnrichmentJob) error {
+	return apperrors.Upstream(errors.New("connection refused"), "Error creating enrichment job")
+}
+
+func TestAsyncEnrichment_QueueFailureTakesThePersonBack(t *testing.T) {
+	personService := newAsyncService(t, nil, enrichstub.Config{})
+	personService.EnrichmentJobs = unavailableJobRepository{memory.NewEnrichmentJobRepository()}
+	router := newTestRouter(t, personService)
+
+	recorder := serve(router, http.MethodPost, "/api/people?async=true", `{"Name": "Dmitriy", "Surname": "Ushakov"}`, nil)
+	if recorder.Code < http.StatusInternalServerError {
+		t.Errorf("Expected a 5xx status, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if _, err := personService.GetPersonByName("Dmitriy"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected the person to be taken back, got %v", err)
+	}
+}
+
+func TestAsyncEnrichment_ClientsCannotSetTheStatus(t *testing.T) {
+	personService := newAsyncService(t, nil, enrichstub.Config{})
+	router := newTestRouter(t, personService)
+
+	recorder := serve(router, http.MethodPost, "/api/people", `{"Name": "Dmitriy", "Surname": "Ushakov", "EnrichmentStatus": "pending"}`, nil)
+	var created entities.Person
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil || recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if person, _ := personService.GetPersonByID(created.ID); person.EnrichmentStatus != "" {
+		t.Errorf("Expected a person enriched right away to have no status, got %q", person.EnrichmentStatus)
+	}
+}
+
+func TestWebhookSender_RejectsPrivateTargets(t *testing.T) {
+	sender := service.NewWebhookSender(service.WebhookConfig{})
+	for _, webhookURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hook",
+		"http://[::1]/hook",
+		"http://100.64.0.1/hook",
+	} {
+		if err := sender.Validate(context.Background(), webhookURL); !errors.Is(err, apperrors.ErrValidation) {
+			t.Errorf("Expected %s to be rejected, got %v", webhookURL, err)
+		}
+	}
+	if err := sender.Validate(context.Background(), "https://93.184.216.34/hook"); err != nil {
+		t.Errorf("Expected a public address to be accepted, got %v", err)
+	}
+
+	// Even without going through Validate, nothing private is connected to
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the webhook not to reach the loopback")
+	}))
+	defer receiver.Close()
+	if err := sender.Send(receiver.URL, map[string]string{}); err == nil {
+		t.Errorf("Expected the loopback webhook to fail")
+	}
+
+	allowList := service.NewWebhookSender(service.WebhookConfig{AllowedHosts: []string{"hooks.example.com"}})
+	if err := allowList.Validate(context.Background(), "https://93.184.216.34/hook"); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("Expected a host off the allow-list to be rejected, got %v", err)
+	}
+}
+
+func TestAsyncEnrichment_RejectsPrivateWebhooks(t *testing.T) {
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), nil)
+	personService.EnrichmentJobs = memory.NewEnrichmentJobRepository()
+	router := newTestRouter(t, personService)
+
+	recorder := serve(router, http.MethodPost, "/api/people?async=true&webhook=http://169.254.169.254/", `{"Name": "Dmitriy", "Surname": "Ushakov"}`, nil)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a link-local webhook, got %d", recorder.Code)
+	}
+	if _, err := personService.GetPersonByName("Dmitriy"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected no person to be created, got %v", err)
+	}
+}
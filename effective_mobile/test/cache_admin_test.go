@@ -0,0 +1,193 @@
+package test
+
+import (
+	"effective_mobile/api"
+	"effective_mobile/enrichment"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCacheAdminRouter(t *testing.T) (*gin.Engine, *enrichment.APIEnricher, *service.PersonServiceImpl, *int64) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	enricher, _, requests := newCachingEnricher(t, enrichment.CacheConfig{}, enrichstub.Config{})
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), enricher)
+	router, err := api.NewRouter(personService, api.Config{AdminToken: testAdminToken, Enricher: enricher})
+	if err != nil {
+		t.Fatalf("Expected no error building the router, got %v", err)
+	}
+	return router, enricher, personService, requests
+}
+
+func TestCacheAdmin_RequiresAdmin(t *testing.T) {
+	router, _, _, _ := newCacheAdminRouter(t)
+
+	if recorder := serve(router, http.MethodGet, "/api/admin/cache/enrichment/Dmitriy", "", nil); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodDelete, "/api/admin/cache/enrichment?pattern=*", "", map[string]string{"X-Admin-Token": "wrong"}); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", recorder.Code)
+	}
+}
+
+func TestCacheAdmin_InspectAndEvict(t *testing.T) {
+	router, enricher, _, requests := newCacheAdminRouter(t)
+	headers := map[string]string{"X-Admin-Token": testAdminToken}
+
+	if recorder := serve(router, http.MethodGet, "/api/admin/cache/enrichment/Dmitriy", "", headers); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 before enrichment, got %d", recorder.Code)
+	}
+
+	if err := enricher.Enrich(&entities.Person{Name: "Dmitriy"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	recorder := serve(router, http.MethodGet, "/api/admin/cache/enrichment/Dmitriy", "", headers)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+	var inspected struct {
+		Key        string
+		Attributes map[string]enrichment.CachedAttribute
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &inspected)
+	if inspected.Key != "enrichment:v2:dmitriy" || inspected.Attributes[enrichment.ProviderNationalize].Value != "UA" {
+		t.Errorf("Expected the cached nationality UA, got %s", recorder.Body.String())
+	}
+
+	if recorder := serve(router, http.MethodDelete, "/api/admin/cache/enrichment/Dmitriy", "", headers); recorder.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", recorder.Code)
+	}
+	if err := enricher.Enrich(&entities.Person{Name: "Dmitriy"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := atomic.LoadInt64(requests); got != 6 {
+		t.Errorf("Expected the evicted name to be fetched again, got %d provider requests", got)
+	}
+}
+
+func TestCacheAdmin_LocalizedEntries(t *testing.T) {
+	router, enricher, _, requests := newCacheAdminRouter(t)
+	headers := map[string]string{"X-Admin-Token": testAdminToken}
+	enrich := func() {
+		t.Helper()
+		if err := enricher.Enrich(&entities.Person{Name: "Dmitriy", CountryID: "UA"}, nil); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	enrich()
+
+	recorder := serve(router, http.MethodGet, "/api/admin/cache/enrichment/Dmitriy", "", headers)
+	var inspected struct {
+		Key        string
+		Countries  []string
+		Attributes map[string]enrichment.CachedAttribute
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &inspected)
+	if len(inspected.Countries) != 1 || inspected.Countries[0] != "UA" {
+		t.Errorf("Expected the results localized to UA to be listed, got %s", recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodGet, "/api/admin/cache/enrichment/Dmitriy?country=ua", "", headers)
+	inspected.Key = ""
+	json.Unmarshal(recorder.Body.Bytes(), &inspected)
+	if recorder.Code != http.StatusOK || inspected.Key != "enrichment:v2:dmitriy@ua" || inspected.Attributes[enrichment.ProviderAgify].Value == "" {
+		t.Errorf("Expected the age localized to UA, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serve(router, http.MethodGet, "/api/admin/cache/enrichment/Dmitriy?country=UKR", "", headers); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for country UKR, got %d", recorder.Code)
+	}
+
+	// Evicting one country keeps the global results
+	if recorder := serve(router, http.MethodDelete, "/api/admin/cache/enrichment/Dmitriy?country=UA", "", headers); recorder.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", recorder.Code)
+	}
+	enrich()
+	if got := atomic.LoadInt64(requests); got != 5 {
+		t.Errorf("Expected only the localized age and gender to be fetched again, got %d provider requests", got)
+	}
+
+	// Evicting the name drops its localized results too
+	if recorder := serve(router, http.MethodDelete, "/api/admin/cache/enrichment/Dmitriy", "", headers); recorder.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodGet, "/api/admin/cache/enrichment/Dmitriy", "", headers); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after eviction, got %d", recorder.Code)
+	}
+	enrich()
+	if got := atomic.LoadInt64(requests); got != 8 {
+		t.Errorf("Expected everything to be fetched again, got %d provider requests", got)
+	}
+}
+
+func TestCacheAdmin_EvictMatching(t *testing.T) {
+	router, enricher, _, requests := newCacheAdminRouter(t)
+	headers := map[string]string{"X-Admin-Token": testAdminToken}
+	for _, name := range []string{"John", "Jane", "Maria"} {
+		if err := enricher.Enrich(&entities.Person{Name: name}, nil); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if recorder := serve(router, http.MethodDelete, "/api/admin/cache/enrichment", "", headers); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a pattern or attribute, got %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodDelete, "/api/admin/cache/enrichment?attribute=height", "", headers); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown attribute, got %d", recorder.Code)
+	}
+
+	recorder := serve(router, http.MethodDelete, "/api/admin/cache/enrichment?pattern=J*&attribute=nationality", "", headers)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"evicted":2}` {
+		t.Fatalf("Expected 2 names evicted, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	for _, name := range []string{"John", "Jane", "Maria"} {
+		if err := enricher.Enrich(&entities.Person{Name: name}, nil); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if got := atomic.LoadInt64(requests); got != 11 {
+		t.Errorf("Expected only the nationality of John and Jane to be fetched again, got %d provider requests", got)
+	}
+
+	recorder = serve(router, http.MethodDelete, "/api/admin/cache/enrichment?pattern=*", "", headers)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"evicted":3}` {
+		t.Errorf("Expected 3 names evicted, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestCacheAdmin_Warm(t *testing.T) {
+	router, enricher, personService, requests := newCacheAdminRouter(t)
+	headers := map[string]string{"X-Admin-Token": testAdminToken}
+	for _, name := range []string{"Olga", "Olga", "Maria"} {
+		if _, err := personService.CreatePerson(&entities.Person{Name: name, Surname: "Ivanova"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if recorder := serve(router, http.MethodPost, "/api/admin/cache/enrichment/warm", `{}`, headers); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without names, got %d", recorder.Code)
+	}
+
+	recorder := serve(router, http.MethodPost, "/api/admin/cache/enrichment/warm", `{"names": ["Dmitriy", "Zyxw"], "fromPeople": true}`, headers)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"warmed":4,"failed":{}}` {
+		t.Fatalf("Expected 4 names warmed, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	before := atomic.LoadInt64(requests)
+
+	for _, name := range []string{"Dmitriy", "Olga", "Maria"} {
+		if err := enricher.Enrich(&entities.Person{Name: name}, nil); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if got := atomic.LoadInt64(requests); got != before {
+		t.Errorf("Expected warmed names to be served from the cache, got %d more provider requests", got-before)
+	}
+}
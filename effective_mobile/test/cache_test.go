@@ -0,0 +1,168 @@
+package test
+
+import (
+	"context"
+	"effective_mobile/cache"
+	"effective_mobile/enrichment"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"effective_mobile/repositories"
+	"effective_mobile/repositories/cached"
+	"effective_mobile/repositories/memory"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// countingPersonRepository counts the GetPersonByID calls reaching the wrapped
+// repository, returning each result only after latency.
+type countingPersonRepository struct {
+	repositories.PersonRepository
+	latency time.Duration
+	reads   int64
+}
+
+func (r *countingPersonRepository) GetPersonByID(personID int) (*entities.Person, error) {
+	atomic.AddInt64(&r.reads, 1)
+	person, err := r.PersonRepository.GetPersonByID(personID)
+	time.Sleep(r.latency)
+	return person, err
+}
+
+func newInvalidator(t *testing.T, redisServer *miniredis.Miniredis) *cache.Invalidator {
+	t.Helper()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	invalidator := cache.NewInvalidator(redisClient, cache.DefaultInvalidationChannel)
+	t.Cleanup(invalidator.Start())
+	return invalidator
+}
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	lru := cache.NewLRU[string, int](2, 0)
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	lru.Get("a")
+	lru.Set("c", 3)
+
+	if _, ok := lru.Get("b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	if value, ok := lru.Get("a"); !ok || value != 1 {
+		t.Errorf("Expected a to be kept, got %d, %v", value, ok)
+	}
+	if lru.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", lru.Len())
+	}
+}
+
+func TestLRU_ExpiresEntries(t *testing.T) {
+	lru := cache.NewLRU[string, int](10, 20*time.Millisecond)
+	lru.Set("a", 1)
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := lru.Get("a"); ok {
+		t.Errorf("Expected a to have expired")
+	}
+}
+
+func TestLocalPersonRepository_CachesAndInvalidates(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	shared := memory.NewPersonRepository()
+	first := &countingPersonRepository{PersonRepository: shared}
+	second := &countingPersonRepository{PersonRepository: shared}
+	config := cached.LocalConfig{Size: 10, TTL: time.Minute}
+	firstReplica := cached.NewLocalPersonRepository(first, config, newInvalidator(t, redisServer))
+	secondReplica := cached.NewLocalPersonRepository(second, config, newInvalidator(t, redisServer))
+
+	created, err := firstReplica.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := secondReplica.GetPersonByID(created.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if reads := atomic.LoadInt64(&second.reads); reads != 1 {
+		t.Errorf("Expected one read of the wrapped repository, got %d", reads)
+	}
+
+	// Callers may change the returned person without touching the cache
+	person, _ := secondReplica.GetPersonByID(created.ID)
+	person.Name = "Mutated"
+
+	if _, err := firstReplica.UpdatePerson(&entities.Person{ID: created.ID, Name: "Johnny", Surname: "Doe"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	eventually(t, "the second replica to see the update", func() bool {
+		person, err := secondReplica.GetPersonByID(created.ID)
+		return err == nil && person.Name == "Johnny"
+	})
+
+	if err := firstReplica.DeletePerson(created.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	eventually(t, "the second replica to see the deletion", func() bool {
+		_, err := secondReplica.GetPersonByID(created.ID)
+		return err != nil
+	})
+}
+
+func TestEnrichmentCache_ServesFromProcessMemoryWithoutRedis(t *testing.T) {
+	enricher, redisServer, requests := newCachingEnricher(t, enrichment.CacheConfig{RedisTimeout: 50 * time.Millisecond}, enrichstub.Config{})
+
+	if err := enricher.Enrich(&entities.Person{Name: "Dmitriy"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	redisServer.Close()
+
+	person := &entities.Person{Name: "Dmitriy"}
+	if err := enricher.Enrich(person, nil); err != nil {
+		t.Fatalf("Expected no error without Redis, got %v", err)
+	}
+	if person.Age != 43 || person.Gender != "male" || person.Nationality != "UA" {
+		t.Errorf("Expected 43, male, UA, got %d, %s, %s", person.Age, person.Gender, person.Nationality)
+	}
+
+	// Names never seen fall back to the providers
+	jane := &entities.Person{Name: "Jane"}
+	if err := enricher.Enrich(jane, nil); err != nil {
+		t.Fatalf("Expected no error without Redis, got %v", err)
+	}
+	if got := atomic.LoadInt64(requests); got != 6 {
+		t.Errorf("Expected 6 provider requests, got %d", got)
+	}
+}
+
+func TestEnrichmentCache_InvalidatesOtherReplicas(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	first := enrichment.NewCache(redisClient, enrichment.CacheConfig{Invalidator: newInvalidator(t, redisServer)})
+	second := enrichment.NewCache(redisClient, enrichment.CacheConfig{Invalidator: newInvalidator(t, redisServer)})
+	ctx := context.Background()
+
+	// The second replica caches the missing entry in process memory
+	if entry, err := second.Get(ctx, "Ivan"); err != nil || len(entry.Attributes) != 0 {
+		t.Fatalf("Expected an empty entry, got %+v, %v", entry, err)
+	}
+
+	err := first.Update(ctx, "Ivan", func(entry enrichment.CacheEntry) {
+		entry.Attributes[enrichment.ProviderGenderize] = first.Found(enrichment.ProviderGenderize, "male", 0.99)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	eventually(t, "the second replica to see the update", func() bool {
+		entry, err := second.Get(ctx, "Ivan")
+		return err == nil && entry.Attributes[enrichment.ProviderGenderize].Value == "male"
+	})
+}
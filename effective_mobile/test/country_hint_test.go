@@ -0,0 +1,102 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/entities"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestAPIEnricher_CountryHint(t *testing.T) {
+	requests := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.Path + " " + r.URL.Query().Get("country_id")
+		w.Write([]byte(`{"age": 43, "gender": "male", "country": [{"country_id": "UA"}]}`))
+	}))
+	defer server.Close()
+
+	redisServer := miniredis.RunT(t)
+	newEnricher := func(countryID string) *enrichment.APIEnricher {
+		redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+		t.Cleanup(func() { redisClient.Close() })
+		return enrichment.NewAPIEnricher(redisClient, enrichment.Config{
+			URLs: enrichment.ProviderURLs{
+				Agify:       server.URL + "/agify",
+				Genderize:   server.URL + "/genderize",
+				Nationalize: server.URL + "/nationalize",
+			},
+			Cache:     enrichment.CacheConfig{LocalSize: -1},
+			CountryID: countryID,
+		})
+	}
+	expectRequests := func(expected ...string) {
+		t.Helper()
+		close(requests)
+		wanted := map[string]bool{}
+		for _, request := range expected {
+			wanted[request] = true
+		}
+		count := 0
+		for request := range requests {
+			count++
+			if !wanted[request] {
+				t.Errorf("Unexpected request %q", request)
+			}
+		}
+		if count != len(expected) {
+			t.Errorf("Expected %d requests, got %d", len(expected), count)
+		}
+		requests = make(chan string, 10)
+	}
+
+	if err := newEnricher("").Enrich(&entities.Person{Name: "Dmitriy", CountryID: "ua"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Nationalize predicts the country, so it is never given one
+	expectRequests("/agify/ UA", "/genderize/ UA", "/nationalize/ ")
+	if !redisServer.Exists("enrichment:v2:dmitriy@ua") || !redisServer.Exists("enrichment:v2:dmitriy") {
+		t.Errorf("Expected the localized and the global results cached apart, got keys %v", redisServer.Keys())
+	}
+
+	// The default country localizes people without a hint; the nationality is cached already
+	if err := newEnricher("pl").Enrich(&entities.Person{Name: "Dmitriy"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expectRequests("/agify/ PL", "/genderize/ PL")
+
+	// The hint of the person wins over the default
+	if err := newEnricher("pl").Enrich(&entities.Person{Name: "Dmitriy", CountryID: "UA"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expectRequests()
+}
+
+func TestPersonService_ValidatesCountryHint(t *testing.T) {
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), nil)
+
+	_, err := personService.CreatePerson(&entities.Person{Name: "Dmitriy", Surname: "Ushakov", CountryID: "UKR"})
+	if !errors.Is(err, apperrors.ErrValidation) || apperrors.FieldErrors(err)["countryId"] == "" {
+		t.Errorf("Expected a countryId validation error, got %v", err)
+	}
+
+	person, err := personService.CreatePerson(&entities.Person{Name: "Dmitriy", Surname: "Ushakov", CountryID: " ua "})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if person.CountryID != "UA" {
+		t.Errorf("Expected the country hint UA, got %q", person.CountryID)
+	}
+
+	router := newTestRouter(t, personService)
+	if recorder := serve(router, http.MethodPost, "/api/people?enrich=false", `{"Name": "Jane", "Surname": "Doe", "CountryID": "12"}`, nil); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for country 12, got %d", recorder.Code)
+	}
+}
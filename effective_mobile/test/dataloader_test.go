@@ -0,0 +1,88 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/dataloader"
+	"effective_mobile/entities"
+	"effective_mobile/service"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPersonLoader_BatchesAndCaches(t *testing.T) {
+	var batches [][]int
+	loader := dataloader.NewPersonLoader(func(personIDs []int) ([]*entities.Person, error) {
+		batches = append(batches, personIDs)
+		var people []*entities.Person
+		for _, personID := range personIDs {
+			if personID != 3 {
+				people = append(people, &entities.Person{ID: personID, Name: "John"})
+			}
+		}
+		return people, nil
+	})
+
+	first := loader.Load(1)
+	second := loader.Load(2)
+	many := loader.LoadMany([]int{2, 3, 1})
+
+	person, err := first()
+	if err != nil || person.ID != 1 {
+		t.Fatalf("Expected person 1, got %+v, %v", person, err)
+	}
+	if person, err := second(); err != nil || person.ID != 2 {
+		t.Fatalf("Expected person 2, got %+v, %v", person, err)
+	}
+
+	people, err := many()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(people) != 3 || people[0].ID != 2 || people[1] != nil || people[2].ID != 1 {
+		t.Errorf("Expected people 2, nil, 1, got %+v", people)
+	}
+
+	if _, err := loader.Load(3)(); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if cached, _ := loader.Load(1)(); cached != person {
+		t.Errorf("Expected the cached person, got %+v", cached)
+	}
+
+	if expected := [][]int{{1, 2, 3}}; !reflect.DeepEqual(batches, expected) {
+		t.Errorf("Expected batches %v, got %v", expected, batches)
+	}
+}
+
+func TestPersonLoader_DoesNotCacheErrors(t *testing.T) {
+	calls := 0
+	loader := dataloader.NewPersonLoader(func(personIDs []int) ([]*entities.Person, error) {
+		calls++
+		if calls == 1 {
+			return nil, apperrors.Upstream(errors.New("connection refused"), "Error fetching people")
+		}
+		return []*entities.Person{{ID: 1}}, nil
+	})
+
+	if _, err := loader.Load(1)(); !errors.Is(err, apperrors.ErrUpstream) {
+		t.Fatalf("Expected upstream error, got %v", err)
+	}
+	if person, err := loader.Load(1)(); err != nil || person.ID != 1 {
+		t.Errorf("Expected person 1 after retry, got %+v, %v", person, err)
+	}
+}
+
+func TestPersonService_GetPeopleByIDs(t *testing.T) {
+	mockRepo := &MockPersonRepository{
+		getPeopleByIDsFunc: func(personIDs []int) ([]*entities.Person, error) {
+			return []*entities.Person{{ID: personIDs[0]}}, nil
+		},
+	}
+	personService := &service.PersonServiceImpl{PersonRepository: mockRepo}
+
+	people, err := personService.GetPeopleByIDs([]int{7})
+	if err != nil || len(people) != 1 || people[0].ID != 7 {
+		t.Errorf("Expected person 7, got %+v, %v", people, err)
+	}
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"database/sql"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"effective_mobile/fio"
+	"testing"
+	"time"
+)
+
+func TestE2E_Memory(t *testing.T) {
+	runE2E(t, func(t *testing.T) *sql.DB { return nil })
+}
+
+func TestE2E_Postgres(t *testing.T) {
+	db := openTestDatabase(t)
+
+	runE2E(t, func(t *testing.T) *sql.DB {
+		if _, err := db.Exec("TRUNCATE persons, person_history, enrichment_jobs RESTART IDENTITY"); err != nil {
+			t.Fatalf("Failed to empty tables: %v", err)
+		}
+		return db
+	})
+}
+
+func runE2E(t *testing.T, openDB func(t *testing.T) *sql.DB) {
+	t.Run("EnrichesAndPersists", func(t *testing.T) {
+		h := newE2EHarness(t, openDB(t), enrichstub.Config{})
+
+		h.Publish(`{"Name": "Dmitriy", "Surname": "Ushakov", "Patronymic": "Vasilevich"}`)
+
+		var person *entities.Person
+		eventually(t, "Dmitriy to be persisted", func() bool {
+			found, err := h.Service.GetPersonByName("Dmitriy")
+			person = found
+			return err == nil
+		})
+		if person.Surname != "Ushakov" || person.Patronymic != "Vasilevich" {
+			t.Errorf("Expected Ushakov Vasilevich, got %s %s", person.Surname, person.Patronymic)
+		}
+		if person.Age != 43 || person.Gender != "male" || person.Nationality != "UA" {
+			t.Errorf("Expected 43, male, UA, got %d, %s, %s", person.Age, person.Gender, person.Nationality)
+		}
+
+		if !h.Redis.Exists("enrichment:v2:dmitriy") {
+			t.Errorf("Expected the enrichment of Dmitriy to be cached in Redis, got keys %v", h.Redis.Keys())
+		}
+
+		history, err := h.Service.GetPersonHistory(person.ID)
+		if err != nil || len(history) != 1 {
+			t.Fatalf("Expected one history entry, got %+v, %v", history, err)
+		}
+		if history[0].Actor != "kafka-consumer" || history[0].Source != entities.SourceKafka {
+			t.Errorf("Expected the change recorded as kafka-consumer via kafka, got %s via %s", history[0].Actor, history[0].Source)
+		}
+	})
+
+	t.Run("InvalidMessagesGoToFailedQueue", func(t *testing.T) {
+		h := newE2EHarness(t, openDB(t), enrichstub.Config{})
+		h.ExpectFailed(2)
+
+		h.Publish(`{"Name": "Dmitriy"`)
+		h.Publish(`{"Name": "Dmitriy"}`)
+
+		failed := h.Failed(2)
+		for i, expectedValue := range []string{`{"Name": "Dmitriy"`, `{"Name": "Dmitriy"}`} {
+			message := failed[i]
+			if message.Topic != fio.FailedTopic {
+				t.Errorf("Expected topic %s, got %s", fio.FailedTopic, message.Topic)
+			}
+			if value, _ := message.Value.Encode(); string(value) != expectedValue {
+				t.Errorf("Expected the original message %s, got %s", expectedValue, value)
+			}
+			if class := header(message, "error_class"); class != "validation" {
+				t.Errorf("Expected error_class validation, got %s", class)
+			}
+			if header(message, "error") == "" {
+				t.Errorf("Expected an error header on %s", expectedValue)
+			}
+		}
+
+		if _, err := h.Service.GetPersonByName("Dmitriy"); err == nil {
+			t.Errorf("Expected no person to be persisted from invalid messages")
+		}
+	})
+
+	t.Run("ProviderFailuresGoToFailedQueue", func(t *testing.T) {
+		h := newE2EHarness(t, openDB(t), enrichstub.Config{ErrorRate: 1})
+		h.ExpectFailed(1)
+
+		h.Publish(`{"Name": "Dmitriy", "Surname": "Ushakov"}`)
+
+		failed := h.Failed(1)
+		if class := header(failed[0], "error_class"); class != "upstream" {
+			t.Errorf("Expected error_class upstream, got %s", class)
+		}
+		if _, err := h.Service.GetPersonByName("Dmitriy"); err == nil {
+			t.Errorf("Expected no person to be persisted when enrichment fails")
+		}
+	})
+	t.Run("ExhaustedQuotaDefersMessages", func(t *testing.T) {
+		// Dmitriy uses up the quota, so Jane waits for the quota window to end
+		h := newE2EHarness(t, openDB(t), enrichstub.Config{Quota: 3, QuotaWindow: 2 * time.Second})
+		start := time.Now()
+
+		h.Publish(`{"Name": "Dmitriy", "Surname": "Ushakov"}`)
+		h.Publish(`{"Name": "Jane", "Surname": "Doe"}`)
+
+		eventually(t, "Jane to be persisted", func() bool {
+			_, err := h.Service.GetPersonByName("Jane")
+			return err == nil
+		})
+		if elapsed := time.Since(start); elapsed < 2*time.Second {
+			t.Errorf("Expected Jane to wait for the quota to reset, took %s", elapsed)
+		}
+		if _, err := h.Service.GetPersonByName("Dmitriy"); err != nil {
+			t.Errorf("Expected Dmitriy to be persisted, got %v", err)
+		}
+	})
+}
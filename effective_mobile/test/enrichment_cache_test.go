@@ -0,0 +1,173 @@
+package test
+
+import (
+	"context"
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newCachingEnricher builds an enricher on miniredis and the provider stub, counting
+// the requests that reach the stub.
+func newCachingEnricher(t *testing.T, cache enrichment.CacheConfig, stubConfig enrichstub.Config) (*enrichment.APIEnricher, *miniredis.Miniredis, *int64) {
+	t.Helper()
+
+	fixtures, err := enrichstub.LoadFixtures("../enrichstub/fixtures.json")
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	stub := enrichstub.NewServer(fixtures, stubConfig)
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		stub.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	enricher := enrichment.NewAPIEnricher(redisClient, enrichment.Config{
+		URLs: enrichment.ProviderURLs{
+			Agify:       server.URL + "/agify",
+			Genderize:   server.URL + "/genderize",
+			Nationalize: server.URL + "/nationalize",
+		},
+		Cache: cache,
+	})
+	return enricher, redisServer, &requests
+}
+
+func TestEnrichmentCache_OneEntryPerName(t *testing.T) {
+	enricher, redisServer, requests := newCachingEnricher(t, enrichment.CacheConfig{AgeTTL: time.Hour, GenderTTL: 2 * time.Hour, NationalityTTL: 3 * time.Hour}, enrichstub.Config{})
+
+	if err := enricher.Enrich(&entities.Person{Name: "Dmitriy"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if keys := redisServer.Keys(); len(keys) != 1 || keys[0] != "enrichment:v2:dmitriy" {
+		t.Fatalf("Expected a single enrichment:v2:dmitriy key, got %v", keys)
+	}
+	if ttl := redisServer.TTL("enrichment:v2:dmitriy"); ttl <= 2*time.Hour || ttl > 3*time.Hour {
+		t.Errorf("Expected the entry to live as long as its longest TTL, got %v", ttl)
+	}
+
+	// Names differing in case share the entry
+	person := &entities.Person{Name: " DMITRIY "}
+	if err := enricher.Enrich(person, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if person.Age != 43 || person.Gender != "male" || person.Nationality != "UA" {
+		t.Errorf("Expected 43, male, UA, got %d, %s, %s", person.Age, person.Gender, person.Nationality)
+	}
+	if got := atomic.LoadInt64(requests); got != 3 {
+		t.Errorf("Expected 3 provider requests, got %d", got)
+	}
+}
+
+func TestEnrichmentCache_AttributesExpireSeparately(t *testing.T) {
+	enricher, redisServer, requests := newCachingEnricher(t, enrichment.CacheConfig{AgeTTL: time.Hour, GenderTTL: 2 * time.Hour, NationalityTTL: 2 * time.Hour}, enrichstub.Config{})
+
+	if err := enricher.Enrich(&entities.Person{Name: "Dmitriy"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Only the age is stale; miniredis does not move the wall clock the entry records
+	entry, err := enricher.Cache().Get(context.Background(), "Dmitriy")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	age := entry.Attributes[enrichment.ProviderAgify]
+	age.ExpiresAt = time.Now().Add(-time.Second)
+	entry.Attributes[enrichment.ProviderAgify] = age
+	if err := enricher.Cache().Set(context.Background(), "Dmitriy", entry); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := enricher.Enrich(&entities.Person{Name: "Dmitriy"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := atomic.LoadInt64(requests); got != 4 {
+		t.Errorf("Expected only the age to be fetched again, got %d provider requests", got)
+	}
+	if !redisServer.Exists("enrichment:v2:dmitriy") {
+		t.Errorf("Expected the entry to be kept")
+	}
+}
+
+func TestEnrichmentCache_NegativeCaching(t *testing.T) {
+	// Without the process memory tier, so that fast-forwarding Redis expires the entry
+	enricher, redisServer, requests := newCachingEnricher(t, enrichment.CacheConfig{NotFoundTTL: time.Minute, LocalSize: -1}, enrichstub.Config{})
+
+	for i := 0; i < 2; i++ {
+		if err := enricher.Enrich(&entities.Person{Name: "Zyxw"}, nil); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Fatalf("Expected not found for an unknown name, got %v", err)
+		}
+	}
+	if got := atomic.LoadInt64(requests); got != 1 {
+		t.Errorf("Expected the unknown name to be looked up once, got %d provider requests", got)
+	}
+	if ttl := redisServer.TTL("enrichment:v2:zyxw"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected a short-lived negative entry, got TTL %v", ttl)
+	}
+
+	redisServer.FastForward(time.Minute)
+	if err := enricher.Enrich(&entities.Person{Name: "Zyxw"}, nil); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("Expected not found for an unknown name, got %v", err)
+	}
+	if got := atomic.LoadInt64(requests); got != 2 {
+		t.Errorf("Expected the name to be looked up again after the negative entry expired, got %d provider requests", got)
+	}
+}
+
+func TestEnrichmentCache_KeyPrefix(t *testing.T) {
+	enricher, redisServer, _ := newCachingEnricher(t, enrichment.CacheConfig{KeyPrefix: "staging:enrichment:v2:"}, enrichstub.Config{})
+
+	if err := enricher.Enrich(&entities.Person{Name: "Dmitriy"}, []string{enrichment.ProviderGenderize, enrichment.ProviderNationalize}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !redisServer.Exists("staging:enrichment:v2:dmitriy") {
+		t.Errorf("Expected the configured prefix, got keys %v", redisServer.Keys())
+	}
+}
+
+func TestEnrichmentCache_CoalescesConcurrentLookups(t *testing.T) {
+	enricher, redisServer, requests := newCachingEnricher(t, enrichment.CacheConfig{}, enrichstub.Config{Latency: 50 * time.Millisecond})
+
+	const lookups = 50
+	var wg sync.WaitGroup
+	for i := 0; i < lookups; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			person := &entities.Person{Name: "Dmitriy"}
+			if err := enricher.Enrich(person, nil); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+				return
+			}
+			if person.Age != 43 || person.Gender != "male" || person.Nationality != "UA" {
+				t.Errorf("Expected 43, male, UA, got %d, %s, %s", person.Age, person.Gender, person.Nationality)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt64(requests); got != 3 {
+		t.Errorf("Expected one request per provider, got %d", got)
+	}
+	entry, err := enricher.Cache().Get(context.Background(), "Dmitriy")
+	if err != nil || len(entry.Attributes) != 3 {
+		t.Errorf("Expected all three attributes cached, got %+v, %v (keys %v)", entry, err, redisServer.Keys())
+	}
+}
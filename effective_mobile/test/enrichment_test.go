@@ -0,0 +1,78 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/entities"
+	"effective_mobile/service"
+	"errors"
+	"testing"
+)
+
+type MockEnricher struct {
+	calls         int
+	skipProviders []string
+}
+
+func (m *MockEnricher) Enrich(person *entities.Person, skipProviders []string) error {
+	m.calls++
+	m.skipProviders = skipProviders
+	person.Age = 42
+	return nil
+}
+
+func newEnrichingService(enricher enrichment.Enricher) *service.PersonServiceImpl {
+	mockRepo := &MockPersonRepository{
+		createPersonFunc: func(person *entities.Person) (*entities.Person, error) {
+			person.ID = 1
+			return person, nil
+		},
+	}
+	return &service.PersonServiceImpl{PersonRepository: mockRepo, Enricher: enricher}
+}
+
+func TestPersonService_CreatePersonWithEnrichment(t *testing.T) {
+	enricher := &MockEnricher{}
+	personService := newEnrichingService(enricher)
+
+	options := service.EnrichOptions{Enrich: true, SkipProviders: []string{enrichment.ProviderGenderize}}
+	createdPerson, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "John", Surname: "Doe", Gender: "male"}, options)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if enricher.calls != 1 || len(enricher.skipProviders) != 1 || enricher.skipProviders[0] != enrichment.ProviderGenderize {
+		t.Errorf("Expected one enrichment skipping genderize, got %d calls skipping %v", enricher.calls, enricher.skipProviders)
+	}
+	if createdPerson.Age != 42 || createdPerson.Gender != "male" {
+		t.Errorf("Expected enriched age and supplied gender, got %+v", createdPerson)
+	}
+}
+
+func TestPersonService_CreatePersonWithoutEnrichment(t *testing.T) {
+	enricher := &MockEnricher{}
+	personService := newEnrichingService(enricher)
+
+	createdPerson, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "John", Surname: "Doe", Age: 30}, service.EnrichOptions{Enrich: false})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if enricher.calls != 0 {
+		t.Errorf("Expected no enrichment, got %d calls", enricher.calls)
+	}
+	if createdPerson.Age != 30 {
+		t.Errorf("Expected supplied age 30, got %d", createdPerson.Age)
+	}
+}
+
+func TestPersonService_CreatePersonUnknownProvider(t *testing.T) {
+	personService := newEnrichingService(&MockEnricher{})
+
+	options := service.EnrichOptions{Enrich: true, SkipProviders: []string{"unknown"}}
+	_, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "John", Surname: "Doe"}, options)
+
+	if !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("Expected ErrValidation, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func newStubEnricher(t *testing.T, config enrichstub.Config) *enrichment.APIEnricher {
+	t.Helper()
+
+	fixtures, err := enrichstub.LoadFixtures("../enrichstub/fixtures.json")
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	stub := httptest.NewServer(enrichstub.NewServer(fixtures, config))
+	t.Cleanup(stub.Close)
+
+	// No Redis is listening, so every lookup goes to the stub
+	redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { redisClient.Close() })
+
+	return enrichment.NewAPIEnricher(redisClient, enrichment.Config{URLs: enrichment.ProviderURLs{
+		Agify:       stub.URL + "/agify",
+		Genderize:   stub.URL + "/genderize",
+		Nationalize: stub.URL + "/nationalize",
+	}})
+}
+
+func TestAPIEnricher_FromStub(t *testing.T) {
+	enricher := newStubEnricher(t, enrichstub.Config{})
+
+	person := &entities.Person{Name: "Dmitriy", Surname: "Ivanov"}
+	if err := enricher.Enrich(person, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if person.Age != 43 || person.Gender != "male" || person.Nationality != "UA" {
+		t.Errorf("Expected 43, male, UA, got %d, %s, %s", person.Age, person.Gender, person.Nationality)
+	}
+
+	unknown := &entities.Person{Name: "Zyxw", Surname: "Doe"}
+	if err := enricher.Enrich(unknown, nil); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected not found for an unknown name, got %v", err)
+	}
+}
+
+func TestAPIEnricher_StubFailures(t *testing.T) {
+	for name, config := range map[string]enrichstub.Config{
+		"errors":     {ErrorRate: 1},
+		"rate limit": {RateLimitRate: 1},
+	} {
+		enricher := newStubEnricher(t, config)
+		if err := enricher.Enrich(&entities.Person{Name: "John", Surname: "Doe"}, nil); !errors.Is(err, apperrors.ErrUpstream) {
+			t.Errorf("Expected an upstream error with injected %s, got %v", name, err)
+		}
+	}
+}
+
+func TestEnrichStub_QuotaAndLatency(t *testing.T) {
+	stub := httptest.NewServer(enrichstub.NewServer(nil, enrichstub.Config{Quota: 1, Latency: 20 * time.Millisecond}))
+	defer stub.Close()
+
+	start := time.Now()
+	resp, err := http.Get(stub.URL + "/agify?name=john")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Rate-Limit-Remaining") != "0" {
+		t.Errorf("Expected 200 with no requests remaining, got %d, %s", resp.StatusCode, resp.Header.Get("X-Rate-Limit-Remaining"))
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Expected the injected latency")
+	}
+
+	resp, err = http.Get(stub.URL + "/agify?name=john")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("X-Rate-Limit-Reset") == "" {
+		t.Errorf("Expected 429 with a reset header, got %d", resp.StatusCode)
+	}
+}
+
+func TestEnrichStub_Record(t *testing.T) {
+	upstreamCalls := 0
+	var upstreamQuery url.Values
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		upstreamQuery = r.URL.Query()
+		w.Write([]byte(`{"count": 5, "name": "` + r.URL.Query().Get("name") + `", "age": 33}`))
+	}))
+	defer upstream.Close()
+
+	fixturesPath := filepath.Join(t.TempDir(), "fixtures.json")
+	stub := httptest.NewServer(enrichstub.NewServer(nil, enrichstub.Config{
+		Record:       true,
+		Upstreams:    enrichment.ProviderURLs{Agify: upstream.URL, Genderize: upstream.URL, Nationalize: upstream.URL},
+		FixturesPath: fixturesPath,
+	}))
+	defer stub.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(stub.URL + "/agify?name=Zoe")
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %v, %v", resp, err)
+		}
+		resp.Body.Close()
+	}
+	if upstreamCalls != 1 {
+		t.Errorf("Expected the second request to be replayed, got %d upstream calls", upstreamCalls)
+	}
+
+	// The localized response is recorded apart, with the key of the client passed on
+	resp, err := http.Get(stub.URL + "/agify?name=Zoe&country_id=ua&apikey=secret")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %v, %v", resp, err)
+	}
+	resp.Body.Close()
+	if upstreamCalls != 2 || upstreamQuery.Get("country_id") != "UA" || upstreamQuery.Get("apikey") != "secret" {
+		t.Errorf("Expected the country and the key to be passed upstream, got %d calls with %v", upstreamCalls, upstreamQuery)
+	}
+
+	fixtures, err := enrichstub.LoadFixtures(fixturesPath)
+	if err != nil {
+		t.Fatalf("Expected the recording to be saved, got %v", err)
+	}
+	if recorded := string(fixtures["agify"]["zoe"]); recorded != `{"count":5,"name":"Zoe","age":33}` {
+		t.Errorf("Unexpected recording %s", recorded)
+	}
+	if _, ok := fixtures["agify"]["zoe@ua"]; !ok {
+		t.Errorf("Expected the response localized to UA to be recorded, got %v", fixtures["agify"])
+	}
+}
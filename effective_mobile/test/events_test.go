@@ -0,0 +1,55 @@
+package test
+
+import (
+	"effective_mobile/entities"
+	"effective_mobile/events"
+	"effective_mobile/service"
+	"testing"
+)
+
+func TestPersonService_PublishesEvents(t *testing.T) {
+	mockRepo := &MockPersonRepository{
+		createPersonFunc: func(person *entities.Person) (*entities.Person, error) {
+			person.ID = 1
+			return person, nil
+		},
+		getPersonByIDFunc: func(personID int) (*entities.Person, error) {
+			return &entities.Person{ID: personID, Name: "John", Surname: "Doe"}, nil
+		},
+		deletePersonFunc: func(personID int) error {
+			return nil
+		},
+	}
+	bus := events.NewBus()
+	personEvents, unsubscribe := bus.Subscribe(4)
+	defer unsubscribe()
+
+	personService := &service.PersonServiceImpl{PersonRepository: mockRepo, Events: bus}
+
+	if _, err := personService.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := personService.DeletePerson(1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	created := <-personEvents
+	if created.Type != events.PersonCreated || created.Person.ID != 1 {
+		t.Errorf("Expected created event for person 1, got %s for %+v", created.Type, created.Person)
+	}
+
+	deleted := <-personEvents
+	if deleted.Type != events.PersonDeleted || deleted.Person.Name != "John" {
+		t.Errorf("Expected deleted event with the deleted person, got %s for %+v", deleted.Type, deleted.Person)
+	}
+}
+
+func TestBus_SlowSubscriberDoesNotBlock(t *testing.T) {
+	bus := events.NewBus()
+	_, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		bus.Publish(events.PersonEvent{Type: events.PersonCreated, Person: &entities.Person{ID: i}})
+	}
+}
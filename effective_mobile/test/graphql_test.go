@@ -0,0 +1,386 @@
+package test
+
+import (
+	"crypto/sha256"
+	"effective_mobile/api"
+	"effective_mobile/api/graphql"
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"effective_mobile/service"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var updateSchema = flag.Bool("update", false, "rewrite schema.graphql from the current schema")
+
+type graphqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newPeopleRepository() *MockPersonRepository {
+	return &MockPersonRepository{
+		getPeopleByIDsFunc: func(personIDs []int) ([]*entities.Person, error) {
+			var people []*entities.Person
+			for _, personID := range personIDs {
+				if personID < 10 {
+					people = append(people, &entities.Person{ID: personID, Name: "John", Surname: "Doe"})
+				}
+			}
+			return people, nil
+		},
+		getPersonByIDFunc: func(personID int) (*entities.Person, error) {
+			return nil, apperrors.NotFound("Person not found")
+		},
+	}
+}
+
+func newGraphQLRouter(t *testing.T, config graphql.Config) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	personService := &service.PersonServiceImpl{PersonRepository: newPeopleRepository()}
+	router, err := api.NewRouter(personService, api.Config{GraphQL: config})
+	if err != nil {
+		t.Fatalf("Expected no error building the router, got %v", err)
+	}
+	return router
+}
+
+func postGraphQL(t *testing.T, router http.Handler, body interface{}) (int, graphqlResponse) {
+	t.Helper()
+	encoded, _ := json.Marshal(body)
+	recorder := serve(router, http.MethodPost, "/graphql", string(encoded), nil)
+
+	var response graphqlResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected a GraphQL response, got %s", recorder.Body)
+	}
+	return recorder.Code, response
+}
+
+func TestGraphQL_Query(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+
+	status, response := postGraphQL(t, router, map[string]interface{}{
+		"query":     `query($ids: [Int!]!) { people(ids: $ids) { id name } person(id: 1) { surname } }`,
+		"variables": map[string]interface{}{"ids": []int{1, 42}},
+	})
+
+	if status != http.StatusOK || len(response.Errors) > 0 {
+		t.Fatalf("Expected a successful response, got %d %+v", status, response.Errors)
+	}
+	if people := string(response.Data["people"]); people != `[{"id":1,"name":"John"},null]` {
+		t.Errorf("Unexpected people %s", people)
+	}
+	if person := string(response.Data["person"]); person != `{"surname":"Doe"}` {
+		t.Errorf("Unexpected person %s", person)
+	}
+}
+
+func TestGraphQL_NotFoundError(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+
+	_, response := postGraphQL(t, router, map[string]interface{}{"query": `{ person(id: 42) { id } }`})
+
+	if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != "NOT_FOUND" {
+		t.Errorf("Expected a NOT_FOUND error, got %+v", response.Errors)
+	}
+}
+
+func TestGraphQL_MutationOverGET(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+
+	query := url.QueryEscape(`mutation { deletePerson(id: 1) }`)
+	recorder := serve(router, http.MethodGet, "/graphql?query="+query, "", nil)
+
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("Expected status 405 allowing POST, got %d", recorder.Code)
+	}
+}
+
+func TestGraphQL_WebSocket(t *testing.T) {
+	server := httptest.NewServer(newGraphQLRouter(t, graphql.Config{AllowedOrigins: []string{"https://app.example.com"}}))
+	defer server.Close()
+	endpoint := "ws" + strings.TrimPrefix(server.URL, "http") + "/graphql"
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+
+	dial := func(origin string) (*websocket.Conn, int) {
+		t.Helper()
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := dialer.Dial(endpoint, header)
+		if resp == nil {
+			t.Fatalf("Expected a handshake response, got %v", err)
+		}
+		if err != nil {
+			return nil, resp.StatusCode
+		}
+		return conn, resp.StatusCode
+	}
+	for _, origin := range []string{"https://evil.example.com", "https://app.example.com.evil.com"} {
+		if conn, status := dial(origin); conn != nil || status != http.StatusForbidden {
+			t.Errorf("Expected status 403 for origin %s, got %d", origin, status)
+		}
+	}
+	for _, origin := range []string{"", server.URL, "https://app.example.com"} {
+		conn, status := dial(origin)
+		if conn == nil {
+			t.Errorf("Expected origin %q to be allowed, got %d", origin, status)
+			continue
+		}
+		conn.Close()
+	}
+
+	conn := openGraphQLWebSocket(t, server.URL)
+	defer conn.Close()
+
+	sendGraphQLWebSocket(t, conn, `{"id": "1", "type": "subscribe", "payload": {"query": "mutation { deletePerson(id: 1) }"}}`)
+	if reply, err := readGraphQLWebSocket(conn); err != nil || reply.Type != "error" || !strings.Contains(string(reply.Payload), "only allowed over POST") {
+		t.Errorf("Expected the mutation to be refused, got %+v, %v", reply, err)
+	}
+
+	sendGraphQLWebSocket(t, conn, `{"id": "2", "type": "subscribe", "payload": {"query": "{ person(id: 1) { name } }"}}`)
+	if reply, err := readGraphQLWebSocket(conn); err != nil || reply.Type != "next" || !strings.Contains(string(reply.Payload), "John") {
+		t.Errorf("Expected the query to run, got %+v, %v", reply, err)
+	}
+}
+
+type graphqlWebSocketMessage struct {
+	ID      string
+	Type    string
+	Payload json.RawMessage
+}
+
+// openGraphQLWebSocket connects to the GraphQL endpoint of the server as a page it
+// serves would, and initialises the connection.
+func openGraphQLWebSocket(t *testing.T, serverURL string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/graphql", http.Header{"Origin": {serverURL}})
+	if err != nil {
+		t.Fatalf("Expected the WebSocket to open, got %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	sendGraphQLWebSocket(t, conn, `{"type": "connection_init"}`)
+	if reply, err := readGraphQLWebSocket(conn); err != nil || reply.Type != "connection_ack" {
+		conn.Close()
+		t.Fatalf("Expected connection_ack, got %+v, %v", reply, err)
+	}
+	return conn
+}
+
+func sendGraphQLWebSocket(t *testing.T, conn *websocket.Conn, message string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatalf("Expected no error writing, got %v", err)
+	}
+}
+
+func readGraphQLWebSocket(conn *websocket.Conn) (graphqlWebSocketMessage, error) {
+	var message graphqlWebSocketMessage
+	err := conn.ReadJSON(&message)
+	return message, err
+}
+
+// Fragment cycles crash the validation of graphql-go, so they must be refused before it
+func TestGraphQL_FragmentCycles(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+	documents := map[string]string{
+		"FRAGMENT_CYCLE":   `query { ...F } fragment F on Query { ...G } fragment G on Query { ...F }`,
+		"UNKNOWN_FRAGMENT": `query { person(id: 1) { ...Missing } }`,
+	}
+	// A cycle the operation never spreads, and one nested in a field
+	unused := `query { person(id: 1) { id } } fragment F on Query { ...G } fragment G on Query { ...F }`
+	nested := `query { ...F } fragment F on Query { person(id: 1) { ...P } } fragment P on Person { history { before { ...P } } }`
+
+	for code, query := range documents {
+		_, response := postGraphQL(t, router, map[string]interface{}{"query": query})
+		if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != code {
+			t.Errorf("Expected a %s error for %s, got %+v", code, query, response.Errors)
+		}
+	}
+	for _, query := range []string{unused, nested} {
+		_, response := postGraphQL(t, router, map[string]interface{}{"query": query})
+		if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != "FRAGMENT_CYCLE" {
+			t.Errorf("Expected a FRAGMENT_CYCLE error for %s, got %+v", query, response.Errors)
+		}
+	}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	conn := openGraphQLWebSocket(t, server.URL)
+	defer conn.Close()
+
+	payload, _ := json.Marshal(map[string]interface{}{"id": "1", "type": "subscribe", "payload": map[string]string{"query": documents["FRAGMENT_CYCLE"]}})
+	sendGraphQLWebSocket(t, conn, string(payload))
+	if reply, err := readGraphQLWebSocket(conn); err != nil || reply.Type != "error" || !strings.Contains(string(reply.Payload), "FRAGMENT_CYCLE") {
+		t.Errorf("Expected the cycle to be refused, got %+v, %v", reply, err)
+	}
+	// The server is still up
+	sendGraphQLWebSocket(t, conn, `{"id": "2", "type": "subscribe", "payload": {"query": "{ person(id: 1) { name } }"}}`)
+	if reply, err := readGraphQLWebSocket(conn); err != nil || reply.Type != "next" {
+		t.Errorf("Expected the next query to run, got %+v, %v", reply, err)
+	}
+}
+
+func TestGraphQL_SubscriptionOverGET(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+
+	query := url.QueryEscape(`subscription { personCreated { id } }`)
+	recorder := serve(router, http.MethodGet, "/graphql?query="+query, "", nil)
+
+	if recorder.Code != http.StatusMethodNotAllowed || strings.Contains(recorder.Body.String(), "personCreated") {
+		t.Errorf("Expected status 405 without running it, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestGraphQL_GETVariablesAndOperationName(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+
+	query := url.Values{
+		"query":         {`query Named($id: Int!) { person(id: $id) { name } } query Other { people(ids: [2]) { surname } }`},
+		"variables":     {`{"id": 1}`},
+		"operationName": {"Named"},
+	}
+	recorder := serve(router, http.MethodGet, "/graphql?"+query.Encode(), "", nil)
+	var response graphqlResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK || len(response.Errors) > 0 {
+		t.Fatalf("Expected a successful response, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if person := string(response.Data["person"]); person != `{"name":"John"}` || response.Data["people"] != nil {
+		t.Errorf("Expected only the named operation with its variables, got %s", recorder.Body.String())
+	}
+
+	query.Set("variables", `[1]`)
+	if recorder := serve(router, http.MethodGet, "/graphql?"+query.Encode(), "", nil); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for variables that are not an object, got %d", recorder.Code)
+	}
+}
+
+func TestGraphQL_MissingQuery(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+
+	for _, body := range []interface{}{map[string]interface{}{}, map[string]interface{}{"variables": map[string]int{"id": 1}}} {
+		_, response := postGraphQL(t, router, body)
+		if len(response.Errors) != 1 || response.Errors[0].Message != "Request must contain a query" {
+			t.Errorf("Expected a missing query error for %v, got %+v", body, response.Errors)
+		}
+	}
+	if recorder := serve(router, http.MethodGet, "/graphql", "", nil); !strings.Contains(recorder.Body.String(), "Request must contain a query") {
+		t.Errorf("Expected a missing query error over GET, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestGraphQL_Batch(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+
+	batch, _ := json.Marshal([]map[string]interface{}{
+		{"query": `{ person(id: 1) { name } }`},
+		{"query": `query($id: Int!) { person(id: $id) { id } }`, "variables": map[string]int{"id": 42}},
+		{},
+	})
+	recorder := serve(router, http.MethodPost, "/graphql", string(batch), nil)
+	var responses []graphqlResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &responses); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("Expected a JSON array of results, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(responses))
+	}
+	if person := string(responses[0].Data["person"]); person != `{"name":"John"}` || len(responses[0].Errors) > 0 {
+		t.Errorf("Expected the first operation to succeed, got %+v", responses[0])
+	}
+	if len(responses[1].Errors) != 1 || responses[1].Errors[0].Extensions["code"] != "NOT_FOUND" {
+		t.Errorf("Expected the second operation to fail on its own, got %+v", responses[1])
+	}
+	if len(responses[2].Errors) != 1 || responses[2].Errors[0].Message != "Request must contain a query" {
+		t.Errorf("Expected the third operation to miss its query, got %+v", responses[2])
+	}
+
+	for _, size := range []int{0, 21} {
+		operations := make([]map[string]string, size)
+		for i := range operations {
+			operations[i] = map[string]string{"query": `{ person(id: 1) { id } }`}
+		}
+		body, _ := json.Marshal(operations)
+		if recorder := serve(router, http.MethodPost, "/graphql", string(body), nil); recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for a batch of %d, got %d", size, recorder.Code)
+		}
+	}
+}
+
+func TestGraphQL_Limits(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{Limits: graphql.Limits{MaxDepth: 3, MaxCost: 20}})
+
+	_, response := postGraphQL(t, router, map[string]interface{}{"query": `{ person(id: 1) { history { before { history { id } } } } }`})
+	if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != "QUERY_TOO_DEEP" {
+		t.Errorf("Expected a QUERY_TOO_DEEP error, got %+v", response.Errors)
+	}
+
+	_, response = postGraphQL(t, router, map[string]interface{}{"query": `{ people(ids: [1, 2, 3, 4, 5, 6, 7]) { id name surname } }`})
+	if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != "QUERY_TOO_COMPLEX" {
+		t.Errorf("Expected a QUERY_TOO_COMPLEX error, got %+v", response.Errors)
+	}
+}
+
+func TestGraphQL_PersistedQueries(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+
+	query := `{ people(ids: [1]) { id } }`
+	sum := sha256.Sum256([]byte(query))
+	extensions := map[string]interface{}{"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hex.EncodeToString(sum[:])}}
+
+	_, response := postGraphQL(t, router, map[string]interface{}{"extensions": extensions})
+	if len(response.Errors) != 1 || response.Errors[0].Message != "PersistedQueryNotFound" {
+		t.Fatalf("Expected PersistedQueryNotFound, got %+v", response.Errors)
+	}
+
+	if _, response = postGraphQL(t, router, map[string]interface{}{"query": query, "extensions": extensions}); len(response.Errors) > 0 {
+		t.Fatalf("Expected the query to be registered, got %+v", response.Errors)
+	}
+
+	_, response = postGraphQL(t, router, map[string]interface{}{"extensions": extensions})
+	if len(response.Errors) > 0 || string(response.Data["people"]) != `[{"id":1}]` {
+		t.Errorf("Expected the persisted query to run, got %+v %s", response.Errors, response.Data["people"])
+	}
+}
+
+// TestGraphQL_SchemaSnapshot fails when the GraphQL schema diverges from the committed
+// schema.graphql, so schema changes show up in review. Run with -update to accept them.
+func TestGraphQL_SchemaSnapshot(t *testing.T) {
+	router := newGraphQLRouter(t, graphql.Config{})
+	printed := serve(router, http.MethodGet, "/graphql/schema.graphql", "", nil).Body.String()
+
+	if *updateSchema {
+		if err := os.WriteFile("../schema.graphql", []byte(printed), 0644); err != nil {
+			t.Fatalf("Failed to update schema.graphql: %v", err)
+		}
+		return
+	}
+
+	snapshot, err := os.ReadFile("../schema.graphql")
+	if err != nil {
+		t.Fatalf("Failed to read schema.graphql: %v", err)
+	}
+	if string(snapshot) != printed {
+		t.Errorf("GraphQL schema differs from schema.graphql; review the change and run `go test ./test -run TestGraphQL_SchemaSnapshot -update`\n\ngot:\n%s", printed)
+	}
+}
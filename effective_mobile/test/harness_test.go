@@ -0,0 +1,140 @@
+package test
+
+import (
+	"database/sql"
+	"effective_mobile/enrichment"
+	"effective_mobile/enrichstub"
+	"effective_mobile/fio"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+const fioTopic = "FIO"
+
+// e2eHarness runs the FIO consumer as application.go wires it, against a mock Kafka
+// broker, miniredis, the enrichment stub and either the in-memory repositories or
+// a test Postgres.
+type e2eHarness struct {
+	t            *testing.T
+	Service      *service.PersonServiceImpl
+	Redis        *miniredis.Miniredis
+	partition    *mocks.PartitionConsumer
+	producer     *mocks.SyncProducer
+	consumerDone chan struct{}
+	failedMu     sync.Mutex
+	failed       []*sarama.ProducerMessage
+}
+
+// newE2EHarness starts the harness on the in-memory repositories, or on db when it is not nil.
+func newE2EHarness(t *testing.T, db *sql.DB, config enrichstub.Config) *e2eHarness {
+	t.Helper()
+
+	fixtures, err := enrichstub.LoadFixtures("../enrichstub/fixtures.json")
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	stub := httptest.NewServer(enrichstub.NewServer(fixtures, config))
+	t.Cleanup(stub.Close)
+
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	enricher := enrichment.NewAPIEnricher(redisClient, enrichment.Config{URLs: enrichment.ProviderURLs{
+		Agify:       stub.URL + "/agify",
+		Genderize:   stub.URL + "/genderize",
+		Nationalize: stub.URL + "/nationalize",
+	}})
+
+	h := &e2eHarness{t: t, Redis: redisServer, consumerDone: make(chan struct{})}
+	if db != nil {
+		h.Service = service.NewPersonService(db, enricher)
+	} else {
+		h.Service = service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), enricher)
+	}
+
+	consumer := mocks.NewConsumer(t, nil)
+	h.partition = consumer.ExpectConsumePartition(fioTopic, 0, sarama.OffsetOldest)
+	partitionConsumer, err := consumer.ConsumePartition(fioTopic, 0, sarama.OffsetOldest)
+	if err != nil {
+		t.Fatalf("Failed to consume %s: %v", fioTopic, err)
+	}
+	h.producer = mocks.NewSyncProducer(t, fio.ProducerConfig())
+
+	go func() {
+		defer close(h.consumerDone)
+		fio.NewConsumer(h.Service, h.producer).Run(partitionConsumer.Messages())
+	}()
+	t.Cleanup(func() {
+		partitionConsumer.Close()
+		<-h.consumerDone
+		consumer.Close()
+		// Fails the test when an expected failed message was never sent
+		h.producer.Close()
+	})
+	return h
+}
+
+// Publish yields a raw FIO message to the consumer.
+func (h *e2eHarness) Publish(value string) {
+	h.partition.YieldMessage(&sarama.ConsumerMessage{Topic: fioTopic, Value: []byte(value)})
+}
+
+// ExpectFailed prepares the producer for count messages sent to FIO_FAILED. Sending
+// more than expected fails the test.
+func (h *e2eHarness) ExpectFailed(count int) {
+	for i := 0; i < count; i++ {
+		h.producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+			h.failedMu.Lock()
+			defer h.failedMu.Unlock()
+			h.failed = append(h.failed, message)
+			return nil
+		})
+	}
+}
+
+// Failed waits for count messages sent to FIO_FAILED and returns them.
+func (h *e2eHarness) Failed(count int) []*sarama.ProducerMessage {
+	h.t.Helper()
+
+	var failed []*sarama.ProducerMessage
+	eventually(h.t, "failed messages", func() bool {
+		h.failedMu.Lock()
+		defer h.failedMu.Unlock()
+		failed = append(failed[:0], h.failed...)
+		return len(failed) >= count
+	})
+	return failed
+}
+
+// eventually polls condition until it holds, failing the test after a few seconds.
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// header returns the value of a message header.
+func header(message *sarama.ProducerMessage, key string) string {
+	for _, h := range message.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"effective_mobile/entities"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+type MockPersonHistoryRepository struct {
+	entries []entities.PersonHistory
+}
+
+func (m *MockPersonHistoryRepository) RecordChange(entry *entities.PersonHistory) error {
+	entry.ID = len(m.entries) + 1
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *MockPersonHistoryRepository) GetHistory(personID int) ([]entities.PersonHistory, error) {
+	var history []entities.PersonHistory
+	for _, entry := range m.entries {
+		if entry.PersonID == personID {
+			history = append(history, entry)
+		}
+	}
+	return history, nil
+}
+
+func TestPersonService_RecordsHistory(t *testing.T) {
+	stored := &entities.Person{ID: 1, Name: "John"}
+	mockRepo := &MockPersonRepository{
+		createPersonFunc: func(person *entities.Person) (*entities.Person, error) {
+			person.ID = 1
+			return person, nil
+		},
+		getPersonByIDFunc: func(personID int) (*entities.Person, error) {
+			return stored, nil
+		},
+		updatePersonFunc: func(person *entities.Person) (*entities.Person, error) {
+			return person, nil
+		},
+		deletePersonFunc: func(personID int) error {
+			return nil
+		},
+	}
+	historyRepo := &MockPersonHistoryRepository{}
+
+	personService := (&service.PersonServiceImpl{PersonRepository: mockRepo, HistoryRepository: historyRepo}).
+		WithOrigin(entities.ChangeOrigin{Actor: "alice", Source: entities.SourceREST})
+
+	if _, err := personService.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := personService.UpdatePerson(&entities.Person{ID: 1, Name: "UpdatedJohn", Surname: "Doe"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := personService.DeletePerson(1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	history, err := personService.GetPersonHistory(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 history entries, got %d", len(history))
+	}
+
+	expectedActions := []string{entities.ActionCreate, entities.ActionUpdate, entities.ActionDelete}
+	for i, entry := range history {
+		if entry.Action != expectedActions[i] {
+			t.Errorf("Expected entry %d to be '%s', got '%s'", i, expectedActions[i], entry.Action)
+		}
+		if entry.Actor != "alice" || entry.Source != entities.SourceREST {
+			t.Errorf("Expected entry %d to be made by alice over rest, got %s over %s", i, entry.Actor, entry.Source)
+		}
+	}
+
+	if history[1].Before.Name != "John" || history[1].After.Name != "UpdatedJohn" {
+		t.Errorf("Expected update snapshots John -> UpdatedJohn, got %s -> %s", history[1].Before.Name, history[1].After.Name)
+	}
+	if history[2].After != nil {
+		t.Errorf("Expected delete to have no after snapshot, got %+v", history[2].After)
+	}
+}
+
+// failingHistoryRepository cannot record anything, like a full person_history table.
+type failingHistoryRepository struct {
+	MockPersonHistoryRepository
+}
+
+func (m *failingHistoryRepository) RecordChange(entry *entities.PersonHistory) error {
+	return errors.New("disk full")
+}
+
+func TestPersonService_ReportsHistoryFailures(t *testing.T) {
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), &failingHistoryRepository{}, nil)
+
+	person, err := personService.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+	if err == nil {
+		t.Fatalf("Expected the history failure to be reported")
+	}
+	if person == nil || person.ID == 0 {
+		t.Fatalf("Expected the saved person along with the error, got %+v", person)
+	}
+	if err := personService.DeletePerson(person.ID); err == nil {
+		t.Errorf("Expected the history failure of the delete to be reported")
+	}
+
+	router := newTestRouter(t, personService)
+	recorder := serve(router, http.MethodPost, "/api/people?enrich=false", `{"Name": "Jane", "Surname": "Doe"}`, nil)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryPersonRepository_SoftDeleteAndPurge(t *testing.T) {
+	repository := memory.NewPersonRepository()
+
+	created, _ := repository.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+	if created.ID != 1 {
+		t.Fatalf("Expected ID 1, got %d", created.ID)
+	}
+
+	if err := repository.DeletePerson(created.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repository.GetPersonByID(created.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected deleted person to be hidden, got %v", err)
+	}
+	if person, err := repository.GetPersonByIDIncludingDeleted(created.ID); err != nil || person.DeletedAt == nil {
+		t.Errorf("Expected deleted person with deletion time, got %+v, %v", person, err)
+	}
+	if err := repository.DeletePerson(created.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected not found deleting twice, got %v", err)
+	}
+
+	if restored, err := repository.RestorePerson(created.ID); err != nil || restored.DeletedAt != nil {
+		t.Errorf("Expected restored person, got %+v, %v", restored, err)
+	}
+	if _, err := repository.RestorePerson(created.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("Expected a conflict restoring a live person, got %v", err)
+	}
+
+	repository.DeletePerson(created.ID)
+	if purged, _ := repository.PurgeDeletedPeople(time.Now().Add(-time.Hour)); len(purged) != 0 {
+		t.Errorf("Expected nothing purged before retention, got %v", purged)
+	}
+	if purged, _ := repository.PurgeDeletedPeople(time.Now().Add(time.Second)); len(purged) != 1 || purged[0] != created.ID {
+		t.Errorf("Expected person %d purged, got %v", created.ID, purged)
+	}
+	if _, err := repository.GetPersonByIDIncludingDeleted(created.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected purged person to be gone, got %v", err)
+	}
+}
+
+func TestMemoryPersonRepository_ReturnsCopies(t *testing.T) {
+	repository := memory.NewPersonRepository()
+	created, _ := repository.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+
+	person, _ := repository.GetPersonByID(created.ID)
+	person.Name = "Changed"
+
+	if stored, _ := repository.GetPersonByName("John"); stored == nil || stored.Name != "John" {
+		t.Errorf("Expected the stored person to be unaffected, got %+v", stored)
+	}
+}
+
+func TestMemoryPersonRepository_ConcurrentCreates(t *testing.T) {
+	repository := memory.NewPersonRepository()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			repository.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+		}()
+	}
+	wg.Wait()
+
+	ids := make([]int, 50)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	if people, _ := repository.GetPeopleByIDs(ids); len(people) != 50 {
+		t.Errorf("Expected 50 people with distinct IDs, got %d", len(people))
+	}
+}
+
+func TestMemoryStorage_ServesTheAPI(t *testing.T) {
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), nil)
+	router := newTestRouter(t, personService)
+
+	if recorder := serve(router, http.MethodPost, "/api/people?enrich=false", `{"Name": "John", "Surname": "Doe"}`, nil); recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodPut, "/api/people/1", `{"Name": "Jane", "Surname": "Doe"}`, nil); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+
+	_, response := postGraphQL(t, router, map[string]interface{}{"query": `{ person(id: 1) { name history { action } } }`})
+	if len(response.Errors) > 0 {
+		t.Fatalf("Expected no errors, got %+v", response.Errors)
+	}
+
+	var person struct {
+		Name    string
+		History []struct{ Action string }
+	}
+	json.Unmarshal(response.Data["person"], &person)
+	if person.Name != "Jane" || len(person.History) != 2 || person.History[1].Action != entities.ActionUpdate {
+		t.Errorf("Expected Jane with create and update history, got %+v", person)
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOfflineEnricher_BundledDataset(t *testing.T) {
+	enricher, err := enrichment.LoadOfflineEnricher("")
+	if err != nil {
+		t.Fatalf("Expected the bundled dataset to load, got %v", err)
+	}
+
+	person := &entities.Person{Name: "Dmitriy"}
+	if err := enricher.Enrich(person, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if person.Age != 43 || person.Gender != "male" || person.Nationality != "UA" || person.EnrichmentSource != entities.EnrichmentSourceOffline {
+		t.Errorf("Expected 43, male, UA from offline, got %d, %s, %s from %s", person.Age, person.Gender, person.Nationality, person.EnrichmentSource)
+	}
+
+	if err := enricher.Enrich(&entities.Person{Name: "Zyxw"}, nil); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected not found for an unknown name, got %v", err)
+	}
+}
+
+func TestOfflineEnricher_CustomDataset(t *testing.T) {
+	dataset := "name,age,gender,gender_probability,nationality,nationality_probability\n" +
+		"Ivan,44,male,1.00,RU,0.11\n" +
+		"Sasha,,,,RU,0.60\n"
+	enricher, err := enrichment.NewOfflineEnricher(strings.NewReader(dataset))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if statistics, ok := enricher.Lookup(" ivan "); !ok || statistics.GenderProbability != 1 || statistics.NationalityProbability != 0.11 {
+		t.Errorf("Expected Ivan's statistics, got %+v, %v", statistics, ok)
+	}
+
+	// Unknown attributes can be skipped
+	sasha := &entities.Person{Name: "Sasha"}
+	if err := enricher.Enrich(sasha, nil); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected not found for Sasha's age, got %v", err)
+	}
+	if err := enricher.Enrich(sasha, []string{enrichment.ProviderAgify, enrichment.ProviderGenderize}); err != nil || sasha.Nationality != "RU" {
+		t.Errorf("Expected Sasha's nationality, got %s, %v", sasha.Nationality, err)
+	}
+
+	if _, err := enrichment.NewOfflineEnricher(strings.NewReader(dataset + "Olga,old,female,1,RU,0.28\n")); err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("Expected an error pointing at line 4, got %v", err)
+	}
+}
+
+func TestFallbackEnricher(t *testing.T) {
+	offline, err := enrichment.LoadOfflineEnricher("")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	healthy := enrichment.NewFallbackEnricher(newStubEnricher(t, enrichstub.Config{}), offline)
+	person := &entities.Person{Name: "Dmitriy"}
+	if err := healthy.Enrich(person, nil); err != nil || person.EnrichmentSource != entities.EnrichmentSourceAPI {
+		t.Errorf("Expected the API to enrich, got %s, %v", person.EnrichmentSource, err)
+	}
+
+	failing := enrichment.NewFallbackEnricher(newStubEnricher(t, enrichstub.Config{RateLimitRate: 1}), offline)
+	person = &entities.Person{Name: "Ivan"}
+	if err := failing.Enrich(person, nil); err != nil {
+		t.Fatalf("Expected the offline dataset to take over, got %v", err)
+	}
+	if person.Age != 44 || person.EnrichmentSource != entities.EnrichmentSourceOffline {
+		t.Errorf("Expected age 44 from offline, got %d from %s", person.Age, person.EnrichmentSource)
+	}
+
+	if err := failing.Enrich(&entities.Person{Name: "Zyxw"}, nil); !errors.Is(err, apperrors.ErrUpstream) {
+		t.Errorf("Expected the API failure when neither knows the name, got %v", err)
+	}
+}
+
+func TestPersonService_EnrichmentSourceIsNotTakenFromInput(t *testing.T) {
+	offline, _ := enrichment.LoadOfflineEnricher("")
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), offline)
+
+	manual, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "Ivan", Surname: "Petrov", Age: 30, EnrichmentSource: entities.EnrichmentSourceAPI}, service.EnrichOptions{})
+	if err != nil || manual.EnrichmentSource != "" {
+		t.Errorf("Expected no enrichment source for a person entered by hand, got %q, %v", manual.EnrichmentSource, err)
+	}
+
+	enriched, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "Ivan", Surname: "Sidorov"}, service.DefaultEnrichOptions)
+	if err != nil || enriched.EnrichmentSource != entities.EnrichmentSourceOffline {
+		t.Errorf("Expected the offline source, got %q, %v", enriched.EnrichmentSource, err)
+	}
+}
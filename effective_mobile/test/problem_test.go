@@ -0,0 +1,55 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/problem"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProblem_WriteValidationError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/people", nil)
+
+	err := apperrors.InvalidFields(map[string]string{"surname": "Surname is required", "name": "Name is required"})
+	problem.Write(c, problem.FromError(err))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != problem.ContentType {
+		t.Errorf("Expected content type %s, got %s", problem.ContentType, contentType)
+	}
+
+	var body problem.Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected problem JSON, got %v", err)
+	}
+
+	if body.Type != "/problems/validation-error" || body.Title != "Bad Request" || body.Status != http.StatusBadRequest {
+		t.Errorf("Unexpected problem %+v", body)
+	}
+	if body.Instance != "/api/people" {
+		t.Errorf("Expected instance /api/people, got '%s'", body.Instance)
+	}
+	if len(body.Errors) != 2 || body.Errors[0].Field != "name" || body.Errors[1].Field != "surname" {
+		t.Errorf("Expected sorted field errors for name and surname, got %+v", body.Errors)
+	}
+}
+
+func TestProblem_FromUpstreamErrorHidesCause(t *testing.T) {
+	p := problem.FromError(apperrors.Upstream(http.ErrHandlerTimeout, "Error fetching person"))
+
+	if p.Status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", p.Status)
+	}
+	if p.Detail != "Error fetching person" {
+		t.Errorf("Expected detail without the cause, got '%s'", p.Detail)
+	}
+}
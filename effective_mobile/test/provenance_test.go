@@ -0,0 +1,216 @@
+package test
+
+import (
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newReEnrichmentService builds a service enriching from a small offline dataset and
+// enriching again from the provider stub.
+func newReEnrichmentService(t *testing.T, stubConfig enrichstub.Config) *service.PersonServiceImpl {
+	t.Helper()
+
+	dataset := "name,age,gender,gender_probability,nationality,nationality_probability\n" +
+		"Dmitriy,40,male,0.90,RU,0.30\n" +
+		"Zyxw,30,female,0.50,PL,0.20\n"
+	offline, err := enrichment.NewOfflineEnricher(strings.NewReader(dataset))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), offline)
+	personService.ReEnricher = newStubEnricher(t, stubConfig)
+	return personService
+}
+
+func TestAPIEnricher_RecordsProvenance(t *testing.T) {
+	enricher, _, requests := newCachingEnricher(t, enrichment.CacheConfig{LocalSize: -1}, enrichstub.Config{})
+
+	person := &entities.Person{Name: "Dmitriy"}
+	if err := enricher.Enrich(person, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	gender := person.Provenance.Gender
+	if gender.Source != entities.EnrichmentSourceAPI || gender.Provider != enrichment.ProviderGenderize || gender.Confidence != 1 || gender.EnrichedAt.IsZero() {
+		t.Errorf("Expected gender from genderize with confidence 1, got %+v", gender)
+	}
+	if nationality := person.Provenance.Nationality; nationality.Provider != enrichment.ProviderNationalize || nationality.Confidence != 0.41 {
+		t.Errorf("Expected nationality from nationalize with confidence 0.41, got %+v", nationality)
+	}
+
+	cached := &entities.Person{Name: "Dmitriy"}
+	if err := enricher.Enrich(cached, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cached.Provenance.Gender.Source != entities.EnrichmentSourceCache || !cached.Provenance.Gender.EnrichedAt.Equal(gender.EnrichedAt) {
+		t.Errorf("Expected gender from the cache, fetched when first enriched, got %+v", cached.Provenance.Gender)
+	}
+	if *requests != 3 {
+		t.Errorf("Expected 3 provider requests, got %d", *requests)
+	}
+
+	// Results cached before fetchedAfter are fetched again
+	refreshed := &entities.Person{Name: "Dmitriy"}
+	if err := enricher.ReEnrich(refreshed, []string{enrichment.ProviderAgify}, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if refreshed.Provenance.Gender.Source != entities.EnrichmentSourceAPI || !refreshed.Provenance.Gender.EnrichedAt.After(gender.EnrichedAt) {
+		t.Errorf("Expected gender fetched again, got %+v", refreshed.Provenance.Gender)
+	}
+	if *requests != 5 {
+		t.Errorf("Expected 5 provider requests, got %d", *requests)
+	}
+}
+
+func TestPersonService_ManualEditsAreNeverOverwritten(t *testing.T) {
+	personService := newReEnrichmentService(t, enrichstub.Config{})
+
+	created, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "Dmitriy", Surname: "Ushakov", Gender: "female"}, service.EnrichOptions{
+		Enrich:        true,
+		SkipProviders: []string{enrichment.ProviderGenderize},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created.Provenance.Gender.Source != entities.EnrichmentSourceManual || created.Provenance.Age.Source != entities.EnrichmentSourceOffline {
+		t.Errorf("Expected a manual gender and an offline age, got %+v", created.Provenance)
+	}
+
+	edit, _ := personService.GetPersonByID(created.ID)
+	edit.Age = 35
+	edited, err := personService.UpdatePerson(edit)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if edited.Provenance.Age.Source != entities.EnrichmentSourceManual || edited.Provenance.Nationality.Source != entities.EnrichmentSourceOffline {
+		t.Errorf("Expected a manual age and an offline nationality, got %+v", edited.Provenance)
+	}
+	if edited.EnrichmentSource != entities.EnrichmentSourceOffline {
+		t.Errorf("Expected the offline source for the remaining attributes, got %q", edited.EnrichmentSource)
+	}
+
+	// An enriched value arriving after the edit, e.g. from a concurrent re-enrichment
+	enriched := *created
+	enriched.Age = 43
+	enriched.Provenance.Age = entities.AttributeProvenance{Source: entities.EnrichmentSourceAPI, Provider: enrichment.ProviderAgify, EnrichedAt: time.Now()}
+	stored, err := personService.UpdatePerson(&enriched)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.Age != 35 || stored.Provenance.Age.Source != entities.EnrichmentSourceManual {
+		t.Errorf("Expected the manual age 35 to be kept, got %d from %+v", stored.Age, stored.Provenance.Age)
+	}
+}
+
+func TestPersonService_ReEnrichPeople(t *testing.T) {
+	personService := newReEnrichmentService(t, enrichstub.Config{})
+
+	dmitriy, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "Dmitriy", Surname: "Ushakov"}, service.DefaultEnrichOptions)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	dmitriy.Age = 35
+	if _, err := personService.UpdatePerson(dmitriy); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The providers do not know Zyxw, so it keeps its offline attributes
+	zyxw, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "Zyxw", Surname: "Doe"}, service.DefaultEnrichOptions)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := personService.CreatePerson(&entities.Person{Name: "Ivan", Surname: "Petrov", Age: 44}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	result, err := personService.WithOrigin(entities.ChangeOrigin{Actor: "re-enrichment-job"}).ReEnrichPeople(service.ReEnrichOptions{MaxAge: time.Hour, Limit: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Checked != 2 || result.Updated != 1 || result.LastID != zyxw.ID {
+		t.Errorf("Expected Dmitriy and Zyxw checked and Dmitriy updated, got %+v", result)
+	}
+
+	person, _ := personService.GetPersonByID(dmitriy.ID)
+	if person.Age != 35 || person.Provenance.Age.Source != entities.EnrichmentSourceManual {
+		t.Errorf("Expected the manual age to be kept, got %d from %+v", person.Age, person.Provenance.Age)
+	}
+	if person.Nationality != "UA" || person.Provenance.Nationality.Source != entities.EnrichmentSourceAPI || person.EnrichmentSource != entities.EnrichmentSourceAPI {
+		t.Errorf("Expected UA from the providers, got %s from %+v", person.Nationality, person.Provenance.Nationality)
+	}
+	history, _ := personService.GetPersonHistory(dmitriy.ID)
+	if last := history[len(history)-1]; last.Actor != "re-enrichment-job" {
+		t.Errorf("Expected the update to be recorded for the job, got %q", last.Actor)
+	}
+
+	person, _ = personService.GetPersonByID(zyxw.ID)
+	if person.Provenance.Gender.Source != entities.EnrichmentSourceOffline {
+		t.Errorf("Expected Zyxw to stay offline, got %+v", person.Provenance)
+	}
+
+	// Only Zyxw is still stale
+	if result, err := personService.ReEnrichPeople(service.ReEnrichOptions{MaxAge: time.Hour, Limit: 10}); err != nil || result.Checked != 1 {
+		t.Errorf("Expected only Zyxw to be checked again, got %+v, %v", result, err)
+	}
+}
+
+func TestPersonService_ReEnrichPeopleStopsWhenRateLimited(t *testing.T) {
+	personService := newReEnrichmentService(t, enrichstub.Config{RateLimitRate: 1})
+
+	for _, surname := range []string{"Ushakov", "Petrov"} {
+		if _, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "Dmitriy", Surname: surname}, service.DefaultEnrichOptions); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	result, err := personService.ReEnrichPeople(service.ReEnrichOptions{MaxAge: time.Hour, Limit: 10})
+	if !errors.Is(err, apperrors.ErrUpstream) || result.Checked != 0 || result.LastID != 0 {
+		t.Errorf("Expected to stop at the first person, got %+v, %v", result, err)
+	}
+}
+
+func TestReEnrichmentEndpoint(t *testing.T) {
+	personService := newReEnrichmentService(t, enrichstub.Config{})
+	router := newTestRouter(t, personService)
+	if _, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "Dmitriy", Surname: "Ushakov"}, service.DefaultEnrichOptions); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if recorder := serve(router, http.MethodPost, "/api/admin/re-enrichment", "", nil); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", recorder.Code)
+	}
+	headers := map[string]string{"X-Admin-Token": testAdminToken}
+	if recorder := serve(router, http.MethodPost, "/api/admin/re-enrichment?limit=0", "", headers); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for limit 0, got %d", recorder.Code)
+	}
+	// Larger passes would outlast the timeouts of clients
+	if recorder := serve(router, http.MethodPost, "/api/admin/re-enrichment?limit=100", "", headers); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for limit 100, got %d", recorder.Code)
+	}
+
+	// Two people are checked without the delay of the job between them
+	if _, err := personService.CreatePersonWithEnrichment(&entities.Person{Name: "Dmitriy", Surname: "Petrov"}, service.DefaultEnrichOptions); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	start := time.Now()
+	recorder := serve(router, http.MethodPost, "/api/admin/re-enrichment?maxAge=1h&limit=5", "", headers)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected no delay between people, took %s", elapsed)
+	}
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var result service.ReEnrichResult
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil || result.Updated != 2 {
+		t.Errorf("Expected two people updated, got %s, %v", recorder.Body.String(), err)
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"context"
+	"effective_mobile/api"
+	"effective_mobile/apperrors"
+	"effective_mobile/enrichment"
+	"effective_mobile/enrichstub"
+	"effective_mobile/entities"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// skipAllButAgify limits enrichment to one request per name.
+var skipAllButAgify = []string{enrichment.ProviderGenderize, enrichment.ProviderNationalize}
+
+// newQuotaReplicas builds replicas of the enricher sharing one Redis and one provider
+// stub, counting the requests that reach the stub.
+func newQuotaReplicas(t *testing.T, replicas int, config enrichment.Config, stubConfig enrichstub.Config) ([]*enrichment.APIEnricher, *int64) {
+	t.Helper()
+
+	fixtures, err := enrichstub.LoadFixtures("../enrichstub/fixtures.json")
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	stub := enrichstub.NewServer(fixtures, stubConfig)
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		stub.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	redisServer := miniredis.RunT(t)
+	config.URLs = enrichment.ProviderURLs{
+		Agify:       server.URL + "/agify",
+		Genderize:   server.URL + "/genderize",
+		Nationalize: server.URL + "/nationalize",
+	}
+	config.Cache.LocalSize = -1
+
+	var enrichers []*enrichment.APIEnricher
+	for i := 0; i < replicas; i++ {
+		redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+		t.Cleanup(func() { redisClient.Close() })
+		enrichers = append(enrichers, enrichment.NewAPIEnricher(redisClient, config))
+	}
+	return enrichers, &requests
+}
+
+func TestAPIEnricher_SendsAPIKeys(t *testing.T) {
+	keys := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys <- r.URL.Path + " " + r.URL.Query().Get("apikey")
+		w.Write([]byte(`{"age": 43, "gender": "male", "country": [{"country_id": "UA"}]}`))
+	}))
+	defer server.Close()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer redisClient.Close()
+	enricher := enrichment.NewAPIEnricher(redisClient, enrichment.Config{
+		URLs: enrichment.ProviderURLs{
+			Agify:       server.URL + "/agify",
+			Genderize:   server.URL + "/genderize",
+			Nationalize: server.URL + "/nationalize",
+		},
+		APIKeys: enrichment.ProviderKeys{Agify: "agify-key", Nationalize: "nationalize-key"},
+	})
+
+	if err := enricher.Enrich(&entities.Person{Name: "Dmitriy"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	close(keys)
+	expected := map[string]bool{"/agify/ agify-key": true, "/genderize/ ": true, "/nationalize/ nationalize-key": true}
+	for key := range keys {
+		if !expected[key] {
+			t.Errorf("Unexpected request %q", key)
+		}
+	}
+}
+
+func TestAPIEnricher_RateLimit(t *testing.T) {
+	enrichers, _ := newQuotaReplicas(t, 1, enrichment.Config{
+		RateLimit: enrichment.RateLimit{RequestsPerSecond: 20, Burst: 1, MaxWait: time.Second},
+	}, enrichstub.Config{})
+
+	start := time.Now()
+	for _, name := range []string{"Dmitriy", "Jane", "John", "Maria"} {
+		if err := enrichers[0].Enrich(&entities.Person{Name: name}, skipAllButAgify); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	// The burst lets the first request through, the others wait 50ms each
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("Expected the requests to be spread over about 150ms, took %s", elapsed)
+	}
+
+	throttled, requests := newQuotaReplicas(t, 1, enrichment.Config{
+		RateLimit: enrichment.RateLimit{RequestsPerSecond: 1, Burst: 1, MaxWait: 10 * time.Millisecond},
+	}, enrichstub.Config{})
+	if err := throttled[0].Enrich(&entities.Person{Name: "Dmitriy"}, skipAllButAgify); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := throttled[0].Enrich(&entities.Person{Name: "Jane"}, skipAllButAgify); !errors.Is(err, apperrors.ErrUpstream) {
+		t.Errorf("Expected an upstream error when the request would wait too long, got %v", err)
+	}
+	if *requests != 1 {
+		t.Errorf("Expected the throttled request not to be sent, got %d requests", *requests)
+	}
+}
+
+func TestAPIEnricher_QuotaSharedAcrossReplicas(t *testing.T) {
+	enrichers, requests := newQuotaReplicas(t, 2, enrichment.Config{}, enrichstub.Config{Quota: 2, QuotaWindow: time.Hour})
+
+	for _, name := range []string{"Dmitriy", "Jane"} {
+		if err := enrichers[0].Enrich(&entities.Person{Name: name}, skipAllButAgify); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	quota, ok := enrichers[1].Quotas().Get(context.Background(), enrichment.ProviderAgify)
+	if !ok || quota.Limit != 2 || quota.Remaining != 0 || !quota.Exhausted() {
+		t.Fatalf("Expected the other replica to see the exhausted quota, got %+v, %v", quota, ok)
+	}
+
+	// The other replica does not even ask
+	err := enrichers[1].Enrich(&entities.Person{Name: "John"}, skipAllButAgify)
+	var quotaErr *enrichment.QuotaExhaustedError
+	if !errors.Is(err, apperrors.ErrUpstream) || !errors.As(err, &quotaErr) || quotaErr.Provider != enrichment.ProviderAgify {
+		t.Errorf("Expected the agify quota to be exhausted, got %v", err)
+	}
+	if *requests != 2 {
+		t.Errorf("Expected 2 provider requests, got %d", *requests)
+	}
+
+	// Cached names are still served
+	if err := enrichers[1].Enrich(&entities.Person{Name: "Jane"}, skipAllButAgify); err != nil {
+		t.Errorf("Expected the cached name to be enriched, got %v", err)
+	}
+}
+
+func TestAPIEnricher_RateLimitedResponseExhaustsQuota(t *testing.T) {
+	enrichers, requests := newQuotaReplicas(t, 1, enrichment.Config{}, enrichstub.Config{RateLimitRate: 1})
+
+	for i := 0; i < 3; i++ {
+		err := enrichers[0].Enrich(&entities.Person{Name: "Dmitriy"}, skipAllButAgify)
+		var quotaErr *enrichment.QuotaExhaustedError
+		if !errors.As(err, &quotaErr) || time.Until(quotaErr.ResetAt) < 50*time.Second {
+			t.Fatalf("Expected the quota to be exhausted for a minute, got %v", err)
+		}
+	}
+	if *requests != 1 {
+		t.Errorf("Expected a single provider request, got %d", *requests)
+	}
+}
+
+func TestCacheAdmin_Quota(t *testing.T) {
+	enrichers, _ := newQuotaReplicas(t, 1, enrichment.Config{}, enrichstub.Config{Quota: 5})
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), enrichers[0])
+	router, err := api.NewRouter(personService, api.Config{AdminToken: testAdminToken, Enricher: enrichers[0]})
+	if err != nil {
+		t.Fatalf("Expected no error building the router, got %v", err)
+	}
+	if err := enrichers[0].Enrich(&entities.Person{Name: "Dmitriy"}, skipAllButAgify); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if recorder := serve(router, http.MethodGet, "/api/admin/enrichment/quota", "", nil); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", recorder.Code)
+	}
+	recorder := serve(router, http.MethodGet, "/api/admin/enrichment/quota", "", map[string]string{"X-Admin-Token": testAdminToken})
+	var quotas map[string]struct {
+		Limit     int  `json:"limit"`
+		Remaining int  `json:"remaining"`
+		Exhausted bool `json:"exhausted"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &quotas); err != nil || len(quotas) != 1 {
+		t.Fatalf("Expected the agify quota only, got %s, %v", recorder.Body.String(), err)
+	}
+	if agify := quotas[enrichment.ProviderAgify]; agify.Limit != 5 || agify.Remaining != 4 || agify.Exhausted {
+		t.Errorf("Expected 4 of 5 requests left, got %+v", agify)
+	}
+}
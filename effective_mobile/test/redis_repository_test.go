@@ -0,0 +1,148 @@
+package test
+
+import (
+	"effective_mobile/entities"
+	"effective_mobile/repositories"
+	"effective_mobile/repositories/cached"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/repositories/repositorytest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newRedisPersonRepository(t *testing.T, personRepository repositories.PersonRepository) (*cached.RedisPersonRepository, *miniredis.Miniredis) {
+	t.Helper()
+
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	return cached.NewRedisPersonRepository(personRepository, redisClient, cached.RedisConfig{Timeout: 50 * time.Millisecond}), redisServer
+}
+
+func TestPersonRepositoryContract_Redis(t *testing.T) {
+	repositorytest.RunPersonRepositoryContract(t, func(t *testing.T) repositories.PersonRepository {
+		repository, _ := newRedisPersonRepository(t, memory.NewPersonRepository())
+		return repository
+	})
+}
+
+func TestPersonRepositoryContract_Local(t *testing.T) {
+	repositorytest.RunPersonRepositoryContract(t, func(t *testing.T) repositories.PersonRepository {
+		return cached.NewLocalPersonRepository(memory.NewPersonRepository(), cached.LocalConfig{Size: 100, TTL: time.Minute}, nil)
+	})
+}
+
+func TestRedisPersonRepository_ReadThrough(t *testing.T) {
+	inner := &countingPersonRepository{PersonRepository: memory.NewPersonRepository()}
+	repository, redisServer := newRedisPersonRepository(t, inner)
+
+	created, err := repository.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := repository.GetPersonByID(created.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if reads := atomic.LoadInt64(&inner.reads); reads != 1 {
+		t.Errorf("Expected one read of the wrapped repository, got %d", reads)
+	}
+	if ttl := redisServer.TTL("person:v2:id:1"); ttl < 10*time.Minute || ttl > 11*time.Minute {
+		t.Errorf("Expected the default TTL with jitter, got %v", ttl)
+	}
+
+	// Found by name through the cached ID
+	if person, err := repository.GetPersonByName("John"); err != nil || person.ID != created.ID {
+		t.Fatalf("Expected John, got %+v, %v", person, err)
+	}
+
+	if _, err := repository.UpdatePerson(&entities.Person{ID: created.ID, Name: "Johnny", Surname: "Doe"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if person, err := repository.GetPersonByID(created.ID); err != nil || person.Name != "Johnny" {
+		t.Errorf("Expected the updated person, got %+v, %v", person, err)
+	}
+	if _, err := repository.GetPersonByName("John"); err == nil {
+		t.Errorf("Expected the old name to be gone after the rename")
+	}
+
+	if err := repository.DeletePerson(created.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repository.GetPersonByID(created.ID); err == nil {
+		t.Errorf("Expected the deleted person to be gone")
+	}
+	if _, err := repository.GetPersonByName("Johnny"); err == nil {
+		t.Errorf("Expected the deleted person to be gone by name")
+	}
+}
+
+func TestRedisPersonRepository_CoalescesMisses(t *testing.T) {
+	inner := &countingPersonRepository{PersonRepository: memory.NewPersonRepository(), latency: 50 * time.Millisecond}
+	repository, _ := newRedisPersonRepository(t, inner)
+	created, _ := repository.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repository.GetPersonByID(created.ID); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reads := atomic.LoadInt64(&inner.reads); reads != 1 {
+		t.Errorf("Expected concurrent misses to share one read, got %d", reads)
+	}
+}
+
+func TestRedisPersonRepository_WithoutRedis(t *testing.T) {
+	inner := &countingPersonRepository{PersonRepository: memory.NewPersonRepository()}
+	repository, redisServer := newRedisPersonRepository(t, inner)
+	created, _ := repository.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+	redisServer.Close()
+
+	if person, err := repository.GetPersonByID(created.ID); err != nil || person.Name != "John" {
+		t.Fatalf("Expected John from the wrapped repository, got %+v, %v", person, err)
+	}
+	if _, err := repository.UpdatePerson(&entities.Person{ID: created.ID, Name: "Johnny", Surname: "Doe"}); err != nil {
+		t.Fatalf("Expected the update to succeed without Redis, got %v", err)
+	}
+	if person, err := repository.GetPersonByID(created.ID); err != nil || person.Name != "Johnny" {
+		t.Errorf("Expected Johnny from the wrapped repository, got %+v, %v", person, err)
+	}
+}
+
+func TestRedisPersonRepository_ReadRacingAnUpdate(t *testing.T) {
+	inner := &countingPersonRepository{PersonRepository: memory.NewPersonRepository(), latency: 100 * time.Millisecond}
+	repository, redisServer := newRedisPersonRepository(t, inner)
+	created, _ := repository.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		repository.GetPersonByID(created.ID)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	if _, err := repository.UpdatePerson(&entities.Person{ID: created.ID, Name: "Johnny", Surname: "Doe"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	<-done
+
+	if redisServer.Exists("person:v2:id:1") {
+		t.Errorf("Expected the person read before the update not to be cached")
+	}
+	if person, err := repository.GetPersonByID(created.ID); err != nil || person.Name != "Johnny" {
+		t.Errorf("Expected Johnny, got %+v, %v", person, err)
+	}
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"database/sql"
+	"effective_mobile/repositories"
+	"effective_mobile/repositories/impl"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/repositories/repositorytest"
+	"net"
+	"os"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	_ "github.com/lib/pq"
+)
+
+func TestPersonRepositoryContract_Memory(t *testing.T) {
+	repositorytest.RunPersonRepositoryContract(t, func(t *testing.T) repositories.PersonRepository {
+		return memory.NewPersonRepository()
+	})
+}
+
+func TestPersonRepositoryContract_Postgres(t *testing.T) {
+	db := openTestDatabase(t)
+
+	repositorytest.RunPersonRepositoryContract(t, func(t *testing.T) repositories.PersonRepository {
+		if _, err := db.Exec("TRUNCATE persons RESTART IDENTITY"); err != nil {
+			t.Fatalf("Failed to empty persons: %v", err)
+		}
+		return impl.NewPersonRepository(db)
+	})
+}
+
+// openTestDatabase connects to TEST_DATABASE_URL, or starts an ephemeral embedded
+// Postgres, and applies data/data.sql. The test is skipped in -short mode or when
+// no database can be started, e.g. when running as root.
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		if testing.Short() {
+			t.Skip("Skipping Postgres tests in short mode; set TEST_DATABASE_URL to use an existing database")
+		}
+		databaseURL = startEmbeddedPostgres(t)
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema, err := os.ReadFile("../data/data.sql")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("Failed to apply schema: %v", err)
+	}
+	return db
+}
+
+func startEmbeddedPostgres(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	port := uint32(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	runtimePath := t.TempDir()
+	config := embeddedpostgres.DefaultConfig().
+		Port(port).
+		Database("effective_mobile_test").
+		RuntimePath(runtimePath).
+		Logger(nil)
+	postgres := embeddedpostgres.NewDatabase(config)
+	if err := postgres.Start(); err != nil {
+		t.Skipf("Skipping Postgres tests, embedded Postgres did not start: %v", err)
+	}
+	t.Cleanup(func() { postgres.Stop() })
+
+	return config.GetConnectionURL() + "?sslmode=disable"
+}
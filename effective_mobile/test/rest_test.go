@@ -0,0 +1,179 @@
+package test
+
+import (
+	"effective_mobile/api"
+	"effective_mobile/apperrors"
+	"effective_mobile/entities"
+	"effective_mobile/problem"
+	"effective_mobile/repositories/memory"
+	"effective_mobile/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testAdminToken = "secret"
+
+func newTestRouter(t *testing.T, personService service.PersonService) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router, err := api.NewRouter(personService, api.Config{AdminToken: testAdminToken})
+	if err != nil {
+		t.Fatalf("Expected no error building the router, got %v", err)
+	}
+	return router
+}
+
+func serve(router http.Handler, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestREST_CreatePerson(t *testing.T) {
+	history := &MockPersonHistoryRepository{}
+	mockRepo := &MockPersonRepository{
+		createPersonFunc: func(person *entities.Person) (*entities.Person, error) {
+			person.ID = 1
+			return person, nil
+		},
+	}
+	router := newTestRouter(t, &service.PersonServiceImpl{PersonRepository: mockRepo, HistoryRepository: history})
+
+	recorder := serve(router, http.MethodPost, "/api/people?enrich=false", `{"Name": "John", "Surname": "Doe"}`, map[string]string{"X-Actor": "alice"})
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var person entities.Person
+	if err := json.Unmarshal(recorder.Body.Bytes(), &person); err != nil || person.ID != 1 || person.Name != "John" {
+		t.Errorf("Expected created person 1, got %s", recorder.Body)
+	}
+	if len(history.entries) != 1 || history.entries[0].Actor != "alice" || history.entries[0].Source != entities.SourceREST {
+		t.Errorf("Expected the creation recorded for alice over REST, got %+v", history.entries)
+	}
+}
+
+func TestREST_CreatePersonValidation(t *testing.T) {
+	router := newTestRouter(t, &service.PersonServiceImpl{PersonRepository: &MockPersonRepository{}})
+
+	recorder := serve(router, http.MethodPost, "/api/people?enrich=false", `{"Name": "John"}`, nil)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", recorder.Code)
+	}
+	var body problem.Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || len(body.Errors) != 1 || body.Errors[0].Field != "surname" {
+		t.Errorf("Expected a surname field error, got %s", recorder.Body)
+	}
+}
+
+func TestREST_GetPerson(t *testing.T) {
+	mockRepo := &MockPersonRepository{
+		getPersonByIDFunc: func(personID int) (*entities.Person, error) {
+			if personID != 1 {
+				return nil, apperrors.NotFound("Person not found")
+			}
+			return &entities.Person{ID: 1, Name: "John", Surname: "Doe"}, nil
+		},
+	}
+	router := newTestRouter(t, &service.PersonServiceImpl{PersonRepository: mockRepo})
+
+	if recorder := serve(router, http.MethodGet, "/api/people/1", "", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodGet, "/api/people/2", "", nil); recorder.Code != http.StatusNotFound || recorder.Header().Get("Content-Type") != problem.ContentType {
+		t.Errorf("Expected a 404 problem, got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	if recorder := serve(router, http.MethodGet, "/api/people/abc", "", nil); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", recorder.Code)
+	}
+}
+
+func TestREST_IncludeDeletedRequiresAdmin(t *testing.T) {
+	mockRepo := &MockPersonRepository{
+		getPersonByIDIncludingDeletedFunc: func(personID int) (*entities.Person, error) {
+			return &entities.Person{ID: personID, Name: "John", Surname: "Doe"}, nil
+		},
+	}
+	router := newTestRouter(t, &service.PersonServiceImpl{PersonRepository: mockRepo})
+
+	if recorder := serve(router, http.MethodGet, "/api/people/1?includeDeleted=true", "", nil); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", recorder.Code)
+	}
+	headers := map[string]string{"X-Admin-Token": testAdminToken}
+	if recorder := serve(router, http.MethodGet, "/api/people/1?includeDeleted=true", "", headers); recorder.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", recorder.Code)
+	}
+}
+
+func TestREST_DeletePerson(t *testing.T) {
+	mockRepo := &MockPersonRepository{
+		deletePersonFunc: func(personID int) error {
+			if personID != 1 {
+				return apperrors.NotFound("Person not found")
+			}
+			return nil
+		},
+	}
+	router := newTestRouter(t, &service.PersonServiceImpl{PersonRepository: mockRepo})
+
+	if recorder := serve(router, http.MethodDelete, "/api/people/1", "", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodDelete, "/api/people/2", "", nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", recorder.Code)
+	}
+}
+
+func TestREST_RestoreLivePerson(t *testing.T) {
+	personService := service.NewPersonServiceWithRepositories(memory.NewPersonRepository(), memory.NewPersonHistoryRepository(), nil)
+	created, err := personService.CreatePerson(&entities.Person{Name: "John", Surname: "Doe"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	router := newTestRouter(t, personService)
+
+	restore := fmt.Sprintf("/api/people/%d/restore", created.ID)
+	if recorder := serve(router, http.MethodPost, restore, "", nil); recorder.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 restoring a live person, got %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodPost, "/api/people/404/restore", "", nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 restoring an unknown person, got %d", recorder.Code)
+	}
+
+	_, response := postGraphQL(t, router, map[string]interface{}{"query": fmt.Sprintf(`mutation { restorePerson(id: %d) { id } }`, created.ID)})
+	if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != "CONFLICT" {
+		t.Errorf("Expected a CONFLICT error, got %+v", response.Errors)
+	}
+
+	personService.DeletePerson(created.ID)
+	if recorder := serve(router, http.MethodPost, restore, "", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected status 200 restoring a deleted person, got %d", recorder.Code)
+	}
+}
+
+func TestREST_UnknownRoute(t *testing.T) {
+	router := newTestRouter(t, &service.PersonServiceImpl{PersonRepository: &MockPersonRepository{}})
+
+	if recorder := serve(router, http.MethodGet, "/api/unknown", "", nil); recorder.Code != http.StatusNotFound || recorder.Header().Get("Content-Type") != problem.ContentType {
+		t.Errorf("Expected a 404 problem, got %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodPatch, "/api/people/1", "", nil); recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", recorder.Code)
+	}
+}
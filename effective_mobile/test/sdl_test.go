@@ -0,0 +1,80 @@
+package test
+
+import (
+	"effective_mobile/sdl"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+func TestPrint(t *testing.T) {
+	colorType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "Color",
+		Values: graphql.EnumValueConfigMap{
+			"RED":   &graphql.EnumValueConfig{Value: 0},
+			"GREEN": &graphql.EnumValueConfig{Value: 1, DeprecationReason: "Use RED"},
+		},
+	})
+	filterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "Filter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"limit": &graphql.InputObjectFieldConfig{Type: graphql.Int, DefaultValue: 10},
+			"color": &graphql.InputObjectFieldConfig{Type: colorType},
+		},
+	})
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Query",
+		Description: "Entry point",
+		Fields: graphql.Fields{
+			"things": &graphql.Field{
+				Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: filterType},
+					"color":  &graphql.ArgumentConfig{Type: colorType, DefaultValue: 1},
+					"name":   &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "a \"b\""},
+				},
+			},
+			"old": &graphql.Field{Type: graphql.Int, DeprecationReason: graphql.DefaultDeprecationReason},
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := `enum Color {
+  GREEN @deprecated(reason: "Use RED")
+  RED
+}
+
+input Filter {
+  color: Color
+  limit: Int = 10
+}
+
+"Entry point"
+type Query {
+  old: Int @deprecated
+  things(color: Color = GREEN, filter: Filter, name: String = "a \"b\""): [String!]
+}
+`
+	if printed := sdl.Print(schema); printed != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, printed)
+	}
+}
+
+func TestPrint_CustomRootTypeNames(t *testing.T) {
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Root",
+		Fields: graphql.Fields{"ok": &graphql.Field{Type: graphql.Boolean}},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := "schema {\n  query: Root\n}\n\ntype Root {\n  ok: Boolean\n}\n"
+	if printed := sdl.Print(schema); printed != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, printed)
+	}
+}
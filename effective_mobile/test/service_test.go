@@ -1,17 +1,26 @@
 package test
 
 import (
+	"effective_mobile/apperrors"
 	"effective_mobile/entities"
 	"effective_mobile/service"
+	"errors"
 	"testing"
+	"time"
 )
 
 type MockPersonRepository struct {
-	createPersonFunc    func(person *entities.Person) (*entities.Person, error)
-	getPersonByIDFunc   func(personID int) (*entities.Person, error)
-	getPersonByNameFunc func(name string) (*entities.Person, error)
-	updatePersonFunc    func(person *entities.Person) (*entities.Person, error)
-	deletePersonFunc    func(personID int) bool
+	createPersonFunc                  func(person *entities.Person) (*entities.Person, error)
+	getPersonByIDFunc                 func(personID int) (*entities.Person, error)
+	getPersonByIDIncludingDeletedFunc func(personID int) (*entities.Person, error)
+	getPeopleByIDsFunc                func(personIDs []int) ([]*entities.Person, error)
+	getPersonByNameFunc               func(name string) (*entities.Person, error)
+	getDistinctNamesFunc              func() ([]string, error)
+	getPeopleToReEnrichFunc           func(enrichedBefore time.Time, afterID, limit int) ([]*entities.Person, error)
+	updatePersonFunc                  func(person *entities.Person) (*entities.Person, error)
+	deletePersonFunc                  func(personID int) error
+	restorePersonFunc                 func(personID int) (*entities.Person, error)
+	purgeDeletedPeopleFunc            func(deletedBefore time.Time) ([]int, error)
 }
 
 func (m *MockPersonRepository) CreatePerson(person *entities.Person) (*entities.Person, error) {
@@ -22,18 +31,42 @@ func (m *MockPersonRepository) GetPersonByID(personID int) (*entities.Person, er
 	return m.getPersonByIDFunc(personID)
 }
 
+func (m *MockPersonRepository) GetPersonByIDIncludingDeleted(personID int) (*entities.Person, error) {
+	return m.getPersonByIDIncludingDeletedFunc(personID)
+}
+
+func (m *MockPersonRepository) GetPeopleByIDs(personIDs []int) ([]*entities.Person, error) {
+	return m.getPeopleByIDsFunc(personIDs)
+}
+
 func (m *MockPersonRepository) GetPersonByName(name string) (*entities.Person, error) {
 	return m.getPersonByNameFunc(name)
 }
 
+func (m *MockPersonRepository) GetDistinctNames() ([]string, error) {
+	return m.getDistinctNamesFunc()
+}
+
+func (m *MockPersonRepository) GetPeopleToReEnrich(enrichedBefore time.Time, afterID, limit int) ([]*entities.Person, error) {
+	return m.getPeopleToReEnrichFunc(enrichedBefore, afterID, limit)
+}
+
 func (m *MockPersonRepository) UpdatePerson(person *entities.Person) (*entities.Person, error) {
 	return m.updatePersonFunc(person)
 }
 
-func (m *MockPersonRepository) DeletePerson(personID int) bool {
+func (m *MockPersonRepository) DeletePerson(personID int) error {
 	return m.deletePersonFunc(personID)
 }
 
+func (m *MockPersonRepository) RestorePerson(personID int) (*entities.Person, error) {
+	return m.restorePersonFunc(personID)
+}
+
+func (m *MockPersonRepository) PurgeDeletedPeople(deletedBefore time.Time) ([]int, error) {
+	return m.purgeDeletedPeopleFunc(deletedBefore)
+}
+
 func TestPersonService_CreatePerson(t *testing.T) {
 	mockRepo := &MockPersonRepository{
 		createPersonFunc: func(person *entities.Person) (*entities.Person, error) {
@@ -41,9 +74,9 @@ func TestPersonService_CreatePerson(t *testing.T) {
 		},
 	}
 
-	service := &service.PersonService{PersonRepository: mockRepo}
+	service := &service.PersonServiceImpl{PersonRepository: mockRepo}
 
-	personToCreate := &entities.Person{Name: "John"}
+	personToCreate := &entities.Person{Name: "John", Surname: "Doe"}
 	createdPerson, err := service.CreatePerson(personToCreate)
 
 	if err != nil {
@@ -62,7 +95,7 @@ func TestPersonService_GetPersonByID(t *testing.T) {
 		},
 	}
 
-	service := &service.PersonService{PersonRepository: mockRepo}
+	service := &service.PersonServiceImpl{PersonRepository: mockRepo}
 
 	personIDToGet := 1
 	person, err := service.GetPersonByID(personIDToGet)
@@ -78,14 +111,17 @@ func TestPersonService_GetPersonByID(t *testing.T) {
 
 func TestPersonService_UpdatePerson(t *testing.T) {
 	mockRepo := &MockPersonRepository{
+		getPersonByIDFunc: func(personID int) (*entities.Person, error) {
+			return &entities.Person{ID: personID, Name: "John", Surname: "Doe"}, nil
+		},
 		updatePersonFunc: func(person *entities.Person) (*entities.Person, error) {
 			return person, nil
 		},
 	}
 
-	service := &service.PersonService{PersonRepository: mockRepo}
+	service := &service.PersonServiceImpl{PersonRepository: mockRepo}
 
-	personToUpdate := &entities.Person{ID: 1, Name: "UpdatedJohn"}
+	personToUpdate := &entities.Person{ID: 1, Name: "UpdatedJohn", Surname: "Doe"}
 	updatedPerson, err := service.UpdatePerson(personToUpdate)
 
 	if err != nil {
@@ -99,17 +135,96 @@ func TestPersonService_UpdatePerson(t *testing.T) {
 
 func TestPersonService_DeletePerson(t *testing.T) {
 	mockRepo := &MockPersonRepository{
-		deletePersonFunc: func(personID int) bool {
-			return true
+		deletePersonFunc: func(personID int) error {
+			return nil
 		},
 	}
 
-	service := &service.PersonService{PersonRepository: mockRepo}
+	service := &service.PersonServiceImpl{PersonRepository: mockRepo}
 
 	personIDToDelete := 1
-	success := service.DeletePerson(personIDToDelete)
+	err := service.DeletePerson(personIDToDelete)
+
+	if err != nil {
+		t.Errorf("Expected successful deletion, got %v", err)
+	}
+}
+
+func TestPersonService_DeletePersonNotFound(t *testing.T) {
+	mockRepo := &MockPersonRepository{
+		deletePersonFunc: func(personID int) error {
+			return apperrors.NotFound("Person not found")
+		},
+	}
+
+	service := &service.PersonServiceImpl{PersonRepository: mockRepo}
+
+	err := service.DeletePerson(1)
+
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPersonService_CreatePersonValidation(t *testing.T) {
+	mockRepo := &MockPersonRepository{
+		createPersonFunc: func(person *entities.Person) (*entities.Person, error) {
+			t.Fatal("Expected invalid person not to reach the repository")
+			return nil, nil
+		},
+	}
+
+	service := &service.PersonServiceImpl{PersonRepository: mockRepo}
+
+	_, err := service.CreatePerson(&entities.Person{Name: "John"})
+
+	if !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("Expected ErrValidation, got %v", err)
+	}
+}
+
+func TestPersonService_RestorePerson(t *testing.T) {
+	mockRepo := &MockPersonRepository{
+		restorePersonFunc: func(personID int) (*entities.Person, error) {
+			return &entities.Person{ID: personID, Name: "John"}, nil
+		},
+	}
+
+	service := &service.PersonServiceImpl{PersonRepository: mockRepo}
+
+	restoredPerson, err := service.RestorePerson(1)
+
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if restoredPerson.DeletedAt != nil {
+		t.Errorf("Expected restored person to have no deletion time, got %v", restoredPerson.DeletedAt)
+	}
+}
+
+func TestPersonService_PurgeDeletedPeople(t *testing.T) {
+	var cutoff time.Time
+	mockRepo := &MockPersonRepository{
+		purgeDeletedPeopleFunc: func(deletedBefore time.Time) ([]int, error) {
+			cutoff = deletedBefore
+			return []int{1, 2}, nil
+		},
+	}
+
+	service := &service.PersonServiceImpl{PersonRepository: mockRepo}
+
+	purged, err := service.PurgeDeletedPeople(24 * time.Hour)
+
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if purged != 2 {
+		t.Errorf("Expected 2 purged people, got %d", purged)
+	}
 
-	if !success {
-		t.Errorf("Expected successful deletion, but deletePersonFunc returned false")
+	if since := time.Since(cutoff); since < 24*time.Hour || since > 25*time.Hour {
+		t.Errorf("Expected purge cutoff one day ago, got %v", cutoff)
 	}
 }